@@ -0,0 +1,244 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/apimgr/gitmessages/src/audit"
+	"github.com/apimgr/gitmessages/src/logging"
+	"github.com/apimgr/gitmessages/src/middleware"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	tokenKey
+)
+
+// withActor records who is making an authenticated request
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorKey, actor))
+}
+
+// withToken records the API token of a request and names it as the actor
+func withToken(r *http.Request, t *APIToken) *http.Request {
+	r = withActor(r, tokenActor(t))
+	return r.WithContext(context.WithValue(r.Context(), tokenKey, t))
+}
+
+// requestToken returns the API token a request was authenticated with
+func requestToken(r *http.Request) *APIToken {
+	t, _ := r.Context().Value(tokenKey).(*APIToken)
+	return t
+}
+
+// Actor returns who made an authenticated request: the admin username for
+// sessions or "token:<id>" for API tokens
+func Actor(r *http.Request) string {
+	actor, _ := r.Context().Value(actorKey).(string)
+	return actor
+}
+
+// tokenActor names an API token in the audit log
+func tokenActor(t *APIToken) string {
+	return "token:" + t.ID
+}
+
+// AuditEvent returns an audit event for action with the actor, client IP
+// and request ID of r
+func AuditEvent(r *http.Request, action string, success bool) audit.Event {
+	return audit.Event{
+		Action:    action,
+		Actor:     Actor(r),
+		IP:        GetClientIP(r),
+		RequestID: middleware.GetRequestID(r.Context()),
+		Success:   success,
+	}
+}
+
+// SetAuditLog sets where admin actions are recorded
+func (h *Handler) SetAuditLog(l *audit.Log) {
+	h.auditMu.Lock()
+	defer h.auditMu.Unlock()
+	h.auditLog = l
+}
+
+// audit returns the audit log; a nil log discards events
+func (h *Handler) audit() *audit.Log {
+	h.auditMu.RLock()
+	defer h.auditMu.RUnlock()
+	return h.auditLog
+}
+
+// handleAPIAudit returns audit events filtered by the query parameters
+// action, actor, ip, since, until and limit, newest first
+func (h *Handler) handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	q, err := audit.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := h.audit().Search(q)
+	if err != nil {
+		logging.Errorf("Admin: %v [request_id=%s]", err, middleware.GetRequestID(r.Context()))
+		writeAPIError(w, r, http.StatusInternalServerError, "Failed to read audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": events, "count": len(events)})
+}
+
+// handleAdminAudit shows the audit log with the same filters as the API
+func (h *Handler) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	q, qerr := audit.ParseQuery(r.URL.Query())
+	var events []audit.Event
+	if qerr == nil {
+		var err error
+		if events, err = h.audit().Search(q); err != nil {
+			logging.Errorf("Admin: %v [request_id=%s]", err, middleware.GetRequestID(r.Context()))
+			http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	message := ""
+	if qerr != nil {
+		message = qerr.Error()
+	}
+	tmpl := template.Must(template.New("audit").Parse(auditTemplate))
+	tmpl.Execute(w, map[string]interface{}{
+		"CSRF":    h.auth.csrfToken(w, r),
+		"Events":  events,
+		"Error":   message,
+		"Action":  r.URL.Query().Get("action"),
+		"Actor":   r.URL.Query().Get("actor"),
+		"IP":      r.URL.Query().Get("ip"),
+		"Since":   r.URL.Query().Get("since"),
+		"Actions": auditActions,
+	})
+}
+
+// auditActions are offered in the filter of the audit page
+var auditActions = []string{
+	audit.ActionLogin, audit.ActionLoginFailed, audit.ActionLogout, audit.ActionSessionRevoked,
+	"token.", audit.ActionTokenUsed, audit.ActionTokenDenied,
+	"config.", audit.ActionConfigReload, audit.ActionConfigChange, audit.ActionCycleReset,
+}
+
+const auditTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Audit Log - GitMessages API</title>
+    <style>
+        :root {
+            --bg-color: #282a36;
+            --fg-color: #f8f8f2;
+            --accent: #bd93f9;
+            --card-bg: #44475a;
+            --green: #50fa7b;
+            --red: #ff5555;
+        }
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: var(--bg-color);
+            color: var(--fg-color);
+            min-height: 100vh;
+        }
+        .navbar {
+            background: var(--card-bg);
+            padding: 1rem 2rem;
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+        }
+        .navbar h1 { color: var(--accent); font-size: 1.5rem; }
+        .navbar a { color: var(--fg-color); text-decoration: none; margin-left: 1rem; }
+        .navbar a:hover { color: var(--accent); }
+        .navbar .logout { display: inline; }
+        .navbar .logout button { background: none; border: none; color: var(--fg-color); font: inherit; margin-left: 1rem; cursor: pointer; }
+        .navbar .logout button:hover { color: var(--accent); }
+        .container { max-width: 1200px; margin: 2rem auto; padding: 0 1rem; }
+        .error { background: var(--red); color: #fff; padding: 1rem; border-radius: 4px; margin-bottom: 1rem; }
+        .card {
+            background: var(--card-bg);
+            padding: 1.5rem;
+            border-radius: 8px;
+        }
+        .card h2 { color: var(--accent); margin-bottom: 1rem; }
+        .filter { display: flex; gap: 0.5rem; flex-wrap: wrap; margin-bottom: 1rem; }
+        .filter input, .filter select {
+            padding: 0.4rem;
+            border: 1px solid var(--bg-color);
+            border-radius: 4px;
+            background: var(--bg-color);
+            color: var(--fg-color);
+        }
+        .filter button { background: var(--accent); color: var(--bg-color); border: none; border-radius: 4px; padding: 0.4rem 1rem; cursor: pointer; }
+        table { width: 100%; border-collapse: collapse; }
+        th, td { text-align: left; padding: 0.5rem; border-bottom: 1px solid var(--bg-color); vertical-align: top; }
+        td.time { white-space: nowrap; }
+        .ok { color: var(--green); }
+        .failed { color: var(--red); }
+        .changes { font-family: monospace; font-size: 0.85rem; }
+    </style>
+</head>
+<body>
+    <nav class="navbar">
+        <h1>GitMessages API Admin</h1>
+        <div>
+            <a href="/admin/dashboard">Dashboard</a>
+            <a href="/admin/settings">Settings</a>
+            <a href="/admin/sessions">Sessions</a>
+            <a href="/admin/audit">Audit</a>
+            <form class="logout" method="POST" action="/admin/logout">
+                <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+                <button type="submit">Logout</button>
+            </form>
+        </div>
+    </nav>
+    <div class="container">
+        {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+        <div class="card">
+            <h2>Audit Log</h2>
+            <form class="filter" method="GET" action="/admin/audit">
+                <select name="action">
+                    <option value="">All actions</option>
+                    {{range .Actions}}<option value="{{.}}"{{if eq . $.Action}} selected{{end}}>{{.}}</option>{{end}}
+                </select>
+                <input type="text" name="actor" placeholder="Actor" value="{{.Actor}}">
+                <input type="text" name="ip" placeholder="IP" value="{{.IP}}">
+                <input type="text" name="since" placeholder="Since (24h or RFC 3339)" value="{{.Since}}">
+                <button type="submit">Filter</button>
+            </form>
+            <table>
+                <tr><th>Time</th><th>Action</th><th>Actor</th><th>IP</th><th>Result</th><th>Details</th><th>Request ID</th></tr>
+                {{range .Events}}
+                <tr>
+                    <td class="time">{{.Time.Local.Format "2006-01-02 15:04:05"}}</td>
+                    <td>{{.Action}}</td>
+                    <td>{{.Actor}}</td>
+                    <td>{{.IP}}</td>
+                    <td>{{if .Success}}<span class="ok">ok</span>{{else}}<span class="failed">failed</span>{{end}}</td>
+                    <td>{{.Detail}}{{if .Changes}}<div class="changes">{{range .Changes}}{{.}}<br>{{end}}</div>{{end}}</td>
+                    <td>{{.RequestID}}</td>
+                </tr>
+                {{else}}
+                <tr><td colspan="7">No matching events</td></tr>
+                {{end}}
+            </table>
+        </div>
+    </div>
+</body>
+</html>`
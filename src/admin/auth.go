@@ -4,18 +4,30 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/crypto/argon2"
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/logging"
 )
 
 // AuthManager handles admin authentication
 type AuthManager struct {
-	sessions       map[string]*Session
-	tokens         map[string]*APIToken
+	sessions       SessionStore
+	bindIP         bool
+	bindUserAgent  bool
+	pending        map[string]*pendingLogin
+	tokens         *TokenStore
+	guard          *LoginGuard
+	argon2         Argon2Params
+	storeHash      func(hash string) error
+	rehashFailed   string
 	mu             sync.RWMutex
 	adminUser      string
 	adminPassHash  string
@@ -24,30 +36,69 @@ type AuthManager struct {
 	sslEnabled     bool
 }
 
-// Session represents an authenticated admin session
+// Session represents an authenticated admin session. ID is the SHA-256 of
+// the session cookie value.
 type Session struct {
-	ID        string
-	Username  string
-	CreatedAt time.Time
-	ExpiresAt time.Time
-	IP        string
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
 }
 
-// APIToken represents a bearer token for API access
+// sessionRefreshInterval limits how often activity extends a session, so a
+// file-backed store is not rewritten on every request
+const sessionRefreshInterval = time.Minute
+
+// APIToken represents a bearer token for API access. Hash is the SHA-256
+// of the token; the token itself is never stored.
 type APIToken struct {
-	Token       string
-	Name        string
-	Permissions []string
-	CreatedAt   time.Time
-	ExpiresAt   time.Time
-	LastUsed    time.Time
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Hash        string    `json:"hash,omitempty"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	RotatedAt   time.Time `json:"rotated_at,omitzero"`
+	ExpiresAt   time.Time `json:"expires_at,omitzero"`
+	LastUsed    time.Time `json:"last_used,omitzero"`
+}
+
+// Expired reports whether the token has passed its expiry time
+func (t *APIToken) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+// Allows reports whether the token grants scope
+func (t *APIToken) Allows(scope string) bool {
+	for _, p := range t.Permissions {
+		if p == ScopeAll || p == scope {
+			return true
+		}
+	}
+	return false
 }
 
+// public returns a copy of the token without its hash
+func (t *APIToken) public() *APIToken {
+	c := *t
+	c.Hash = ""
+	c.Permissions = append([]string(nil), t.Permissions...)
+	return &c
+}
+
+// staticToken stands for server.admin.api_token, which grants everything
+var staticToken = APIToken{ID: "config", Name: "server.admin.api_token", Permissions: []string{ScopeAll}}
+
 // NewAuthManager creates a new auth manager
-func NewAuthManager(adminUser, adminPass, apiToken string, sessionTimeout int, sslEnabled bool) *AuthManager {
+func NewAuthManager(adminUser, adminPass, apiToken string, sessionTimeout int, sslEnabled bool, tokens *TokenStore) *AuthManager {
 	am := &AuthManager{
-		sessions:       make(map[string]*Session),
-		tokens:         make(map[string]*APIToken),
+		sessions:       NewMemorySessionStore(),
+		pending:        make(map[string]*pendingLogin),
+		tokens:         tokens,
+		guard:          NewLoginGuard(config.DefaultConfig().Server.Admin.Lockout),
+		argon2:         DefaultArgon2Params,
 		adminUser:      adminUser,
 		adminPassHash:  adminPass,
 		apiToken:       apiToken,
@@ -61,6 +112,23 @@ func NewAuthManager(adminUser, adminPass, apiToken string, sessionTimeout int, s
 	return am
 }
 
+// UpdateCredentials replaces the admin credentials and static API token.
+// Existing sessions stay valid.
+func (am *AuthManager) UpdateCredentials(adminUser, adminPass, apiToken string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.adminUser = adminUser
+	am.adminPassHash = adminPass
+	am.apiToken = apiToken
+}
+
+// SetSessionTimeout changes the lifetime of new and refreshed sessions
+func (am *AuthManager) SetSessionTimeout(seconds int) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.sessionTimeout = seconds
+}
+
 // Authenticate validates username and password
 func (am *AuthManager) Authenticate(username, password string) bool {
 	am.mu.RLock()
@@ -89,30 +157,57 @@ func (am *AuthManager) Authenticate(username, password string) bool {
 	return subtle.ConstantTimeCompare([]byte(password), []byte(am.adminPassHash)) == 1
 }
 
-// CreateSession creates a new admin session
-func (am *AuthManager) CreateSession(username, ip string) *Session {
+// SetSessionStore replaces the session store. Sessions in the old store
+// are not carried over.
+func (am *AuthManager) SetSessionStore(store SessionStore) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.sessions = store
+}
+
+// SetSessionBinding ties sessions to the client IP and/or User-Agent they
+// were created from
+func (am *AuthManager) SetSessionBinding(ip, userAgent bool) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
+	am.bindIP, am.bindUserAgent = ip, userAgent
+}
+
+// store returns the current session store
+func (am *AuthManager) store() SessionStore {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.sessions
+}
+
+// CreateSession creates a new admin session and returns it with the cookie
+// value that identifies it
+func (am *AuthManager) CreateSession(username, ip, userAgent string) (*Session, string) {
+	am.mu.RLock()
+	timeout := am.sessionTimeout
+	am.mu.RUnlock()
 
-	sessionID := generateSecureToken(32)
+	token := generateSecureToken(32)
+	now := time.Now()
 	session := &Session{
-		ID:        sessionID,
+		ID:        hashToken(token),
 		Username:  username,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(time.Duration(am.sessionTimeout) * time.Second),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(timeout) * time.Second),
+		LastSeen:  now,
 		IP:        ip,
+		UserAgent: userAgent,
 	}
 
-	am.sessions[sessionID] = session
-	return session
+	if err := am.store().Put(session); err != nil {
+		logging.Warnf("%v", err)
+	}
+	return session, token
 }
 
 // GetSession retrieves a session by ID
 func (am *AuthManager) GetSession(sessionID string) (*Session, bool) {
-	am.mu.RLock()
-	defer am.mu.RUnlock()
-
-	session, ok := am.sessions[sessionID]
+	session, ok := am.store().Get(sessionID)
 	if !ok {
 		return nil, false
 	}
@@ -124,58 +219,82 @@ func (am *AuthManager) GetSession(sessionID string) (*Session, bool) {
 	return session, true
 }
 
+// ListSessions returns the active sessions, newest first
+func (am *AuthManager) ListSessions() ([]*Session, error) {
+	all, err := am.store().List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := all[:0]
+	for _, s := range all {
+		if now.Before(s.ExpiresAt) {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
 // DeleteSession removes a session
 func (am *AuthManager) DeleteSession(sessionID string) {
-	am.mu.Lock()
-	defer am.mu.Unlock()
-	delete(am.sessions, sessionID)
+	if err := am.store().Delete(sessionID); err != nil {
+		logging.Warnf("%v", err)
+	}
 }
 
 // RefreshSession extends a session's expiration
 func (am *AuthManager) RefreshSession(sessionID string) bool {
-	am.mu.Lock()
-	defer am.mu.Unlock()
-
-	session, ok := am.sessions[sessionID]
+	session, ok := am.GetSession(sessionID)
 	if !ok {
 		return false
 	}
 
-	session.ExpiresAt = time.Now().Add(time.Duration(am.sessionTimeout) * time.Second)
+	now := time.Now()
+	if now.Sub(session.LastSeen) < sessionRefreshInterval {
+		return true
+	}
+	am.mu.RLock()
+	timeout := am.sessionTimeout
+	am.mu.RUnlock()
+
+	session.LastSeen = now
+	session.ExpiresAt = now.Add(time.Duration(timeout) * time.Second)
+	if err := am.store().Put(session); err != nil {
+		logging.Warnf("%v", err)
+	}
 	return true
 }
 
-// ValidateAPIToken validates a bearer token
-func (am *AuthManager) ValidateAPIToken(token string) bool {
+// ValidateAPIToken returns the API token matching a bearer token: the
+// static token from config or one from the token store
+func (am *AuthManager) ValidateAPIToken(token string) (*APIToken, bool) {
 	am.mu.RLock()
-	defer am.mu.RUnlock()
+	static := am.apiToken
+	am.mu.RUnlock()
 
 	// Check static token from config
-	if am.apiToken != "" {
-		if subtle.ConstantTimeCompare([]byte(token), []byte(am.apiToken)) == 1 {
-			return true
+	if static != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(static)) == 1 {
+			t := staticToken
+			return &t, true
 		}
 	}
 
 	// Check dynamic tokens
-	apiToken, ok := am.tokens[token]
-	if !ok {
-		return false
-	}
-
-	if time.Now().After(apiToken.ExpiresAt) {
-		return false
+	if am.tokens == nil {
+		return nil, false
 	}
-
-	apiToken.LastUsed = time.Now()
-	return true
+	return am.tokens.Lookup(token)
 }
 
-// SetSessionCookie sets the admin session cookie
-func (am *AuthManager) SetSessionCookie(w http.ResponseWriter, session *Session) {
+// SetSessionCookie sets the admin session cookie to the value returned by
+// CreateSession
+func (am *AuthManager) SetSessionCookie(w http.ResponseWriter, token string) {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
 	http.SetCookie(w, &http.Cookie{
 		Name:     "admin_session",
-		Value:    session.ID,
+		Value:    token,
 		Path:     "/admin",
 		HttpOnly: true,
 		Secure:   am.sslEnabled,
@@ -195,13 +314,30 @@ func (am *AuthManager) ClearSessionCookie(w http.ResponseWriter) {
 	})
 }
 
-// GetSessionFromRequest extracts session from request cookie
+// GetSessionFromRequest extracts session from request cookie. Sessions
+// bound to an IP or User-Agent only match requests from the same client.
 func (am *AuthManager) GetSessionFromRequest(r *http.Request) (*Session, bool) {
 	cookie, err := r.Cookie("admin_session")
 	if err != nil {
 		return nil, false
 	}
-	return am.GetSession(cookie.Value)
+	session, ok := am.GetSession(hashToken(cookie.Value))
+	if !ok {
+		return nil, false
+	}
+
+	am.mu.RLock()
+	bindIP, bindUA := am.bindIP, am.bindUserAgent
+	am.mu.RUnlock()
+	if bindIP && session.IP != GetClientIP(r) {
+		logging.Warnf("admin: session of %q used from %s, bound to %s", session.Username, GetClientIP(r), session.IP)
+		return nil, false
+	}
+	if bindUA && session.UserAgent != r.UserAgent() {
+		logging.Warnf("admin: session of %q used with a different User-Agent from %s", session.Username, GetClientIP(r))
+		return nil, false
+	}
+	return session, true
 }
 
 // GetTokenFromRequest extracts bearer token from Authorization header
@@ -233,81 +369,114 @@ func (am *AuthManager) cleanup() {
 	defer am.mu.Unlock()
 
 	now := time.Now()
-	for id, session := range am.sessions {
-		if now.After(session.ExpiresAt) {
-			delete(am.sessions, id)
+	if err := am.sessions.DeleteExpired(now); err != nil {
+		logging.Warnf("%v", err)
+	}
+	for id, p := range am.pending {
+		if now.After(p.ExpiresAt) {
+			delete(am.pending, id)
 		}
 	}
+	am.guard.cleanup()
 
-	for id, token := range am.tokens {
-		if now.After(token.ExpiresAt) {
-			delete(am.tokens, id)
+	// Persist token last-used times
+	if am.tokens != nil {
+		if err := am.tokens.Flush(); err != nil {
+			logging.Warnf("%v", err)
 		}
 	}
 }
 
-// GetClientIP extracts the client IP from the request
-func GetClientIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		parts := strings.Split(forwarded, ",")
-		return strings.TrimSpace(parts[0])
+// trustedProxies holds the prefixes of reverse proxies allowed to set the
+// client IP with forwarding headers
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// SetTrustedProxies sets the IPs or CIDRs of reverse proxies whose
+// X-Forwarded-For, X-Real-IP and X-Forwarded-Host headers are believed
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		prefix, err := config.ParseProxy(p)
+		if err != nil {
+			return fmt.Errorf("failed to parse trusted proxy: %w", err)
+		}
+		prefixes = append(prefixes, prefix)
 	}
+	trustedProxies.Store(&prefixes)
+	return nil
+}
 
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+// isTrustedProxy reports whether ip is a configured reverse proxy
+func isTrustedProxy(ip string) bool {
+	prefixes := trustedProxies.Load()
+	if prefixes == nil {
+		return false
 	}
-
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
 	}
-	return ip
-}
-
-// generateSecureToken generates a cryptographically secure random token
-func generateSecureToken(length int) string {
-	bytes := make([]byte, length)
-	if _, err := rand.Read(bytes); err != nil {
-		return base64.URLEncoding.EncodeToString([]byte(time.Now().String()))[:length]
+	addr = addr.Unmap()
+	for _, p := range *prefixes {
+		if p.Contains(addr) {
+			return true
+		}
 	}
-	return base64.URLEncoding.EncodeToString(bytes)[:length]
+	return false
 }
 
-// HashPassword creates an Argon2id hash of the password
-func HashPassword(password string) (string, error) {
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
+// remoteIP returns the address of the peer without its port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
+}
 
-	hash := argon2.IDKey([]byte(password), salt, 3, 64*1024, 4, 32)
-
-	// Format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
-	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
-	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
-
-	return "$argon2id$v=19$m=65536,t=3,p=4$" + b64Salt + "$" + b64Hash, nil
+// fromTrustedProxy reports whether the request came through a configured
+// reverse proxy, so its forwarding headers can be believed
+func fromTrustedProxy(r *http.Request) bool {
+	return isTrustedProxy(remoteIP(r))
 }
 
-// verifyArgon2Hash verifies a password against an Argon2id hash
-func verifyArgon2Hash(password, encodedHash string) bool {
-	parts := strings.Split(encodedHash, "$")
-	if len(parts) != 6 {
-		return false
+// GetClientIP returns the client IP of the request. Forwarding headers are
+// only used when the peer is a trusted proxy; X-Forwarded-For is read from
+// the right, skipping trusted proxies, as clients can prepend to it.
+func GetClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
 	}
 
-	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
-	if err != nil {
-		return false
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			ip = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return ip
 	}
 
-	expectedHash, err := base64.RawStdEncoding.DecodeString(parts[5])
-	if err != nil {
-		return false
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
 	}
+	return ip
+}
 
-	hash := argon2.IDKey([]byte(password), salt, 3, 64*1024, 4, 32)
-	return subtle.ConstantTimeCompare(hash, expectedHash) == 1
+// generateSecureToken generates a cryptographically secure random token
+func generateSecureToken(length int) string {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return base64.URLEncoding.EncodeToString([]byte(time.Now().String()))[:length]
+	}
+	return base64.URLEncoding.EncodeToString(bytes)[:length]
 }
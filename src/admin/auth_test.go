@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"}); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", "", "", "192.0.2.1"},
+		{"untrusted forwarded", "192.0.2.1:1234", "198.51.100.7", "", "192.0.2.1"},
+		{"untrusted real ip", "192.0.2.1:1234", "", "198.51.100.7", "192.0.2.1"},
+		{"trusted forwarded", "10.0.0.2:1234", "198.51.100.7", "", "198.51.100.7"},
+		{"spoofed first hop", "10.0.0.2:1234", "203.0.113.9, 198.51.100.7", "", "198.51.100.7"},
+		{"proxy chain", "10.0.0.2:1234", "198.51.100.7, 10.1.2.3", "", "198.51.100.7"},
+		{"only proxies", "10.0.0.2:1234", "10.1.2.3", "", "10.1.2.3"},
+		{"invalid hop", "10.0.0.2:1234", "198.51.100.7, junk", "", "10.0.0.2"},
+		{"trusted real ip", "10.0.0.2:1234", "", "198.51.100.7", "198.51.100.7"},
+		{"trusted ipv6", "[2001:db8::1]:443", "198.51.100.7", "", "198.51.100.7"},
+		{"untrusted ipv6", "[2001:db8::2]:443", "198.51.100.7", "", "2001:db8::2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			if tc.realIP != "" {
+				req.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := GetClientIP(req); got != tc.want {
+				t.Errorf("GetClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxiesRejectsInvalid(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+	if err := SetTrustedProxies([]string{"proxy.example"}); err == nil {
+		t.Error("host name accepted")
+	}
+}
@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/audit"
+	"github.com/apimgr/gitmessages/src/health"
+	"github.com/apimgr/gitmessages/src/logging"
+	"github.com/apimgr/gitmessages/src/middleware"
+)
+
+// processStart is when the process started, for uptime
+var processStart = time.Now()
+
+// Dashboard settings
+const (
+	dashboardRefresh  = 5 * time.Second
+	recentAuditEvents = 10
+)
+
+// SetHealthCheck sets how the dashboard runs the server's health checks
+func (h *Handler) SetHealthCheck(fn func(ctx context.Context) health.Report) {
+	h.healthMu.Lock()
+	defer h.healthMu.Unlock()
+	h.healthCheck = fn
+}
+
+// statusData collects the status shown on the dashboard and returned by
+// /api/v1/admin/status. Status is the health check result, "unknown"
+// without checks. Recent audit events are only included when withAudit is
+// set.
+func (h *Handler) statusData(ctx context.Context, withAudit bool) map[string]interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	uptime := time.Since(processStart)
+
+	status := map[string]interface{}{
+		"status":         "unknown",
+		"version":        h.version,
+		"commit":         h.commit,
+		"buildDate":      h.buildDate,
+		"started_at":     processStart.UTC().Format(time.RFC3339),
+		"uptime":         uptime.Round(time.Second).String(),
+		"uptime_seconds": int64(uptime.Seconds()),
+		"memory": map[string]interface{}{
+			"alloc":      m.Alloc,
+			"totalAlloc": m.TotalAlloc,
+			"sys":        m.Sys,
+			"numGC":      m.NumGC,
+		},
+		"runtime": map[string]interface{}{
+			"goroutines": runtime.NumGoroutine(),
+			"cpus":       runtime.NumCPU(),
+			"goVersion":  runtime.Version(),
+		},
+	}
+
+	h.healthMu.RLock()
+	check := h.healthCheck
+	h.healthMu.RUnlock()
+	if check != nil {
+		report := check(ctx)
+		status["status"] = report.Status
+		status["health"] = report
+	}
+	if sessions, err := h.auth.ListSessions(); err == nil {
+		status["sessions"] = map[string]interface{}{"active": len(sessions)}
+	}
+	if withAudit {
+		if events, err := h.audit().Search(audit.Query{Limit: recentAuditEvents}); err == nil {
+			status["recent_audit"] = events
+		}
+	}
+
+	h.statusMu.RLock()
+	for name, fn := range h.statusProviders {
+		status[name] = fn()
+	}
+	h.statusMu.RUnlock()
+	return status
+}
+
+// handleAPIStatus returns the dashboard data as JSON; recent audit events
+// need the audit:read scope
+func (h *Handler) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.statusData(r.Context(), token != nil && token.Allows(ScopeAuditRead)))
+}
+
+// handleAdminEvents streams the dashboard data as server-sent events until
+// the client goes away or the session ends
+func (h *Handler) handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		// The server's write timeout would otherwise end the stream
+		rc.SetWriteDeadline(time.Now().Add(2 * dashboardRefresh))
+
+		data, err := json.Marshal(h.statusData(r.Context(), true))
+		if err != nil {
+			logging.Errorf("Admin: failed to encode status: %v [request_id=%s]", err, middleware.GetRequestID(r.Context()))
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		if _, ok := h.auth.GetSessionFromRequest(r); !ok {
+			return
+		}
+	}
+}
+
+// handleAdminDashboard shows the admin dashboard
+func (h *Handler) handleAdminDashboard(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.New("dashboard").Parse(dashboardTemplate))
+	tmpl.Execute(w, map[string]interface{}{
+		"Version":   h.version,
+		"Commit":    h.commit,
+		"BuildDate": h.buildDate,
+		"StartedAt": processStart.Format("2006-01-02 15:04:05"),
+		"Refresh":   int(dashboardRefresh.Seconds()),
+		"CSRF":      h.auth.csrfToken(w, r),
+	})
+}
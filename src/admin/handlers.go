@@ -1,45 +1,149 @@
 package admin
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
-	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/apimgr/gitmessages/src/audit"
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/health"
+	"github.com/apimgr/gitmessages/src/logging"
+	"github.com/apimgr/gitmessages/src/middleware"
 )
 
+// auditInterval is how often a client IP or token may add a rejected API
+// request, and a token a read on one route, to the audit log; the rest are
+// counted
+const auditInterval = time.Minute
+
 // Handler manages admin routes and authentication
 type Handler struct {
 	auth      *AuthManager
+	tokens    *TokenStore
+	twoFactor *TwoFactor
 	version   string
 	commit    string
 	buildDate string
+
+	statusMu        sync.RWMutex
+	statusProviders map[string]func() interface{}
+
+	auditMu  sync.RWMutex
+	auditLog *audit.Log
+	denied   *audit.Limiter
+	reads    *audit.Limiter
+
+	restartMu    sync.RWMutex
+	needsRestart func(key string) bool
+
+	healthMu    sync.RWMutex
+	healthCheck func(ctx context.Context) health.Report
 }
 
-// NewHandler creates a new admin handler
-func NewHandler(username, password, apiToken string, sessionTimeout int, sslEnabled bool, version, commit, buildDate string) *Handler {
-	return &Handler{
-		auth:      NewAuthManager(username, password, apiToken, sessionTimeout, sslEnabled),
-		version:   version,
-		commit:    commit,
-		buildDate: buildDate,
+// NewHandler creates a new admin handler. API tokens are kept in dataDir.
+func NewHandler(username, password, apiToken string, sessionTimeout int, sslEnabled bool, dataDir, version, commit, buildDate string) *Handler {
+	tokens := NewTokenStore(dataDir)
+	h := &Handler{
+		auth:            NewAuthManager(username, password, apiToken, sessionTimeout, sslEnabled, tokens),
+		tokens:          tokens,
+		twoFactor:       NewTwoFactor(dataDir),
+		version:         version,
+		commit:          commit,
+		buildDate:       buildDate,
+		statusProviders: make(map[string]func() interface{}),
+		denied:          audit.NewLimiter(auditInterval),
+		reads:           audit.NewLimiter(auditInterval),
 	}
+	h.AddStatusProvider("login", h.auth.guard.Status)
+	return h
+}
+
+// UpdateConfig applies reloaded admin credentials and session timeout
+func (h *Handler) UpdateConfig(username, password, apiToken string, sessionTimeout int) {
+	h.auth.UpdateCredentials(username, password, apiToken)
+	h.auth.SetSessionTimeout(sessionTimeout)
+}
+
+// SetSessionStore replaces the admin session store
+func (h *Handler) SetSessionStore(store SessionStore) {
+	h.auth.SetSessionStore(store)
+}
+
+// SetSessionPolicy applies the session timeout and client binding settings
+func (h *Handler) SetSessionPolicy(c config.SessionConfig) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultConfig().Server.Session.Timeout
+	}
+	h.auth.SetSessionTimeout(timeout)
+	h.auth.SetSessionBinding(c.BindIP, c.BindUserAgent)
+}
+
+// SetLockoutPolicy applies the login lockout settings
+func (h *Handler) SetLockoutPolicy(policy config.LockoutConfig) {
+	h.auth.guard.SetPolicy(policy)
+}
+
+// SetPasswordHashing sets the Argon2 cost of the admin password and how an
+// upgraded hash is stored. The password is rehashed at the next login when
+// it is plain text or was hashed with other settings.
+func (h *Handler) SetPasswordHashing(c config.Argon2Config, store func(hash string) error) {
+	h.auth.SetPasswordHashing(Argon2ParamsFromConfig(c), store)
+}
+
+// Close writes pending API token last-used times
+func (h *Handler) Close() error {
+	return h.tokens.Flush()
+}
+
+// AddStatusProvider adds a named section to the admin status response
+func (h *Handler) AddStatusProvider(name string, fn func() interface{}) {
+	h.statusMu.Lock()
+	defer h.statusMu.Unlock()
+	h.statusProviders[name] = fn
 }
 
 // RegisterRoutes registers admin routes on http.ServeMux
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	h.registerRoutes(mux)
+}
+
+// routeMux is where registerRoutes adds routes
+type routeMux interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+func (h *Handler) registerRoutes(mux routeMux) {
 	// Admin web interface (session auth)
 	mux.HandleFunc("/admin", h.handleAdminLogin)
-	mux.HandleFunc("/admin/login", h.handleAdminLoginPost)
-	mux.HandleFunc("/admin/logout", h.handleAdminLogout)
+	mux.HandleFunc("/admin/login", h.requireCSRF(h.handleAdminLoginPost))
+	mux.HandleFunc("/admin/login/2fa", h.requireCSRF(h.handleAdminLoginTOTP))
+	mux.HandleFunc("/admin/logout", h.requireCSRF(h.handleAdminLogout))
 	mux.HandleFunc("/admin/dashboard", h.requireSession(h.handleAdminDashboard))
-	mux.HandleFunc("/admin/settings", h.requireSession(h.handleAdminSettings))
+	mux.HandleFunc("/admin/events", h.requireSession(h.handleAdminEvents))
+	mux.HandleFunc("/admin/settings", h.requireSession(h.requireCSRF(h.handleAdminSettings)))
+	mux.HandleFunc("/admin/sessions", h.requireSession(h.handleAdminSessions))
+	mux.HandleFunc("/admin/sessions/revoke", h.requireSession(h.requireCSRF(h.handleAdminRevokeSession)))
+	mux.HandleFunc("/admin/audit", h.requireSession(h.handleAdminAudit))
 
 	// Admin API (bearer token auth)
-	mux.HandleFunc("/api/v1/admin/status", h.requireToken(h.handleAPIStatus))
-	mux.HandleFunc("/api/v1/admin/config", h.requireToken(h.handleAPIGetConfig))
-	mux.HandleFunc("/api/v1/admin/reload", h.requireToken(h.handleAPIReload))
+	mux.HandleFunc("/api/v1/admin/status", h.RequireToken(ScopeStatusRead, h.handleAPIStatus))
+	mux.HandleFunc("/api/v1/admin/config", h.RequireToken(ScopeConfigRead, h.handleAPIGetConfig))
+	mux.HandleFunc("PATCH /api/v1/admin/config", h.RequireToken(ScopeConfigWrite, h.handleAPIPatchConfig))
+	mux.HandleFunc("/api/v1/admin/reload", h.RequireToken(ScopeReload, h.handleAPIReload))
+	mux.HandleFunc("/api/v1/admin/audit", h.RequireToken(ScopeAuditRead, h.handleAPIAudit))
+	mux.HandleFunc("/api/v1/admin/tokens", h.RequireToken(ScopeTokensAdmin, h.handleAPITokens))
+	mux.HandleFunc("/api/v1/admin/tokens/{id}", h.RequireToken(ScopeTokensAdmin, h.handleAPIToken))
+	mux.HandleFunc("/api/v1/admin/tokens/{id}/rotate", h.RequireToken(ScopeTokensAdmin, h.handleAPIRotateToken))
 }
 
 // Middleware for session authentication
@@ -52,24 +156,95 @@ func (h *Handler) requireSession(next http.HandlerFunc) http.HandlerFunc {
 		}
 		// Refresh session on activity
 		h.auth.RefreshSession(session.ID)
-		next(w, r)
+		next(w, withActor(r, session.Username))
 	}
 }
 
-// Middleware for bearer token authentication
-func (h *Handler) requireToken(next http.HandlerFunc) http.HandlerFunc {
+// RequireToken is middleware for bearer token authentication. Tokens
+// without scope get 403 naming the missing scope.
+func (h *Handler) RequireToken(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := GetTokenFromRequest(r)
-		if token == "" || !h.auth.ValidateAPIToken(token) {
+		var token *APIToken
+		secret := GetTokenFromRequest(r)
+		if secret != "" {
+			token, _ = h.auth.ValidateAPIToken(secret)
+		}
+		if token == nil {
+			if ok, suppressed := h.denied.Allow("ip " + GetClientIP(r)); ok {
+				logging.Warnf("admin: rejected API request %s %s from %s%s [request_id=%s]",
+					r.Method, r.URL.Path, GetClientIP(r), suppressedNote(suppressed, "rejected"), middleware.GetRequestID(r.Context()))
+				e := AuditEvent(r, audit.ActionTokenDenied, false)
+				e.Detail = r.Method + " " + r.URL.Path + ": missing or invalid token" + suppressedNote(suppressed, "rejected")
+				h.audit().Record(e)
+			}
+			writeAPIError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		r = withToken(r, token)
+		if !token.Allows(scope) {
+			if ok, suppressed := h.denied.Allow("token " + token.ID); ok {
+				logging.Warnf("admin: token %s (%s) lacks scope %s for %s %s%s [request_id=%s]",
+					token.ID, token.Name, scope, r.Method, r.URL.Path, suppressedNote(suppressed, "rejected"), middleware.GetRequestID(r.Context()))
+				e := AuditEvent(r, audit.ActionTokenDenied, false)
+				e.Detail = r.Method + " " + r.URL.Path + ": missing scope " + scope + suppressedNote(suppressed, "rejected")
+				h.audit().Record(e)
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":         "Forbidden",
+				"missing_scope": scope,
+				"request_id":    middleware.GetRequestID(r.Context()),
+			})
 			return
 		}
+		// Reads such as metrics scrapes would crowd out the events the
+		// audit log is for, so each token and route logs one a minute
+		suppressed := 0
+		record := !readOnlyScope(scope)
+		if !record {
+			record, suppressed = h.reads.Allow("token " + token.ID + " " + r.Pattern)
+		}
+		if record {
+			e := AuditEvent(r, audit.ActionTokenUsed, true)
+			e.Detail = r.Method + " " + r.URL.Path + suppressedNote(suppressed, "used")
+			h.audit().Record(e)
+		}
 		next(w, r)
 	}
 }
 
+// suppressedNote mentions n requests, described by what, left out of the
+// logs
+func suppressedNote(n int, what string) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d more %s since the last entry)", n, what)
+}
+
+// TokenAllows reports whether r carries a valid API token with scope, for
+// public endpoints that show more to token holders
+func (h *Handler) TokenAllows(r *http.Request, scope string) bool {
+	secret := GetTokenFromRequest(r)
+	if secret == "" {
+		return false
+	}
+	token, _ := h.auth.ValidateAPIToken(secret)
+	return token != nil && token.Allows(scope)
+}
+
+// writeAPIError writes a JSON error response with the request ID
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      msg,
+		"request_id": middleware.GetRequestID(r.Context()),
+	})
+}
+
 // handleAdminLogin shows the login page
 func (h *Handler) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 	// Check if already logged in
@@ -78,7 +253,7 @@ func (h *Handler) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.renderLoginPage(w, "")
+	h.renderLoginPage(w, h.auth.csrfToken(w, r), "")
 }
 
 // handleAdminLoginPost processes login form
@@ -90,107 +265,369 @@ func (h *Handler) handleAdminLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	username := r.FormValue("username")
 	password := r.FormValue("password")
+	ip := GetClientIP(r)
+	csrf := h.auth.csrfToken(w, r)
+
+	// Throttled attempts are refused before the password is checked and
+	// get the same message as a wrong password
+	if wait, ok := h.auth.guard.Check(ip, username); !ok {
+		logging.Warnf("admin: login throttled for %q from %s, retry in %s [request_id=%s]",
+			username, ip, wait.Round(time.Second), middleware.GetRequestID(r.Context()))
+		h.auditLogin(r, username, false, "throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.renderLoginPage(w, csrf, loginFailedMessage)
+		return
+	}
 
 	if h.auth.Authenticate(username, password) {
-		session := h.auth.CreateSession(username, GetClientIP(r))
-		h.auth.SetSessionCookie(w, session)
-		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		// The stored password is only rehashed once the login is complete
+		upgrade := h.auth.preparePasswordUpgrade(password)
+		if h.twoFactor.Enabled() {
+			h.auth.guard.Release(ip, username)
+			log.Printf("admin: password accepted for %q from %s, waiting for second factor [request_id=%s]",
+				username, ip, middleware.GetRequestID(r.Context()))
+			h.auth.startPendingLogin(w, username, ip, upgrade)
+			h.renderTOTPPage(w, csrf, "")
+			return
+		}
+		h.completeLogin(w, r, username, ip, "password", upgrade)
 		return
 	}
 
-	h.renderLoginPage(w, "Invalid username or password")
+	h.auth.guard.Failure(ip, username)
+	logging.Warnf("admin: login failed for %q from %s [request_id=%s]",
+		username, ip, middleware.GetRequestID(r.Context()))
+	h.auditLogin(r, username, false, "wrong username or password")
+	w.WriteHeader(http.StatusUnauthorized)
+	h.renderLoginPage(w, csrf, loginFailedMessage)
+}
+
+// handleAdminLoginTOTP checks the second factor of a login whose password
+// was accepted
+func (h *Handler) handleAdminLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	id, pending, ok := h.auth.pendingLoginFromRequest(r)
+	if !ok {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	ip := GetClientIP(r)
+	csrf := h.auth.csrfToken(w, r)
+
+	if wait, ok := h.auth.guard.Check(ip, pending.Username); !ok {
+		h.auditLogin(r, pending.Username, false, "throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.renderTOTPPage(w, csrf, loginFailedMessage)
+		return
+	}
+
+	recovery, ok := h.twoFactor.Verify(r.FormValue("code"))
+	if ok {
+		h.auth.endPendingLogin(w, id)
+		if recovery {
+			log.Printf("admin: recovery code used for %q from %s, %d left [request_id=%s]",
+				pending.Username, ip, h.twoFactor.RecoveryCodesLeft(), middleware.GetRequestID(r.Context()))
+		}
+		method := "password and TOTP code"
+		if recovery {
+			method = "password and recovery code"
+		}
+		h.completeLogin(w, r, pending.Username, ip, method, pending.Upgrade)
+		return
+	}
+
+	h.auth.guard.Failure(ip, pending.Username)
+	logging.Warnf("admin: second factor failed for %q from %s [request_id=%s]",
+		pending.Username, ip, middleware.GetRequestID(r.Context()))
+	h.auditLogin(r, pending.Username, false, "wrong second factor")
+	if !h.auth.failPendingLogin(id) {
+		h.auth.endPendingLogin(w, id)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.renderLoginPage(w, csrf, loginFailedMessage)
+		return
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	h.renderTOTPPage(w, csrf, "Invalid code")
+}
+
+// completeLogin starts a session for a fully authenticated admin and
+// stores the rehashed password, if any; method says which factors were
+// checked
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, username, ip, method string, upgrade *passwordUpgrade) {
+	h.auth.guard.Success(ip, username)
+	log.Printf("admin: login succeeded for %q from %s [request_id=%s]",
+		username, ip, middleware.GetRequestID(r.Context()))
+	h.auditLogin(r, username, true, method)
+	if h.auth.applyPasswordUpgrade(upgrade) {
+		e := AuditEvent(r, audit.ActionConfigChange, true)
+		e.Actor = username
+		e.Detail = "admin password rehashed"
+		e.Changes = []config.Change{{Key: "server.admin.password", Old: "********", New: "********"}}
+		h.audit().Record(e)
+	}
+	_, token := h.auth.CreateSession(username, ip, r.UserAgent())
+	h.auth.SetSessionCookie(w, token)
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// auditLogin records a login attempt for username
+func (h *Handler) auditLogin(r *http.Request, username string, success bool, detail string) {
+	action := audit.ActionLogin
+	if !success {
+		action = audit.ActionLoginFailed
+	}
+	e := AuditEvent(r, action, success)
+	e.Actor = username
+	e.Detail = detail
+	h.audit().Record(e)
 }
 
-// handleAdminLogout logs out the user
+// loginFailedMessage is shown for every failed or throttled login so the
+// response does not reveal which check failed
+const loginFailedMessage = "Invalid username or password, or too many attempts. Try again later."
+
+// handleAdminLogout logs out the user; only POST is accepted so links and
+// images on other sites cannot log the admin out
 func (h *Handler) handleAdminLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 	if session, ok := h.auth.GetSessionFromRequest(r); ok {
 		h.auth.DeleteSession(session.ID)
+		h.audit().Record(AuditEvent(withActor(r, session.Username), audit.ActionLogout, true))
 	}
 	h.auth.ClearSessionCookie(w)
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-// handleAdminDashboard shows the admin dashboard
-func (h *Handler) handleAdminDashboard(w http.ResponseWriter, r *http.Request) {
-	h.renderDashboardPage(w)
+// handleAdminSessions lists active admin sessions
+func (h *Handler) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	current, _ := h.auth.GetSessionFromRequest(r)
+	sessions, err := h.auth.ListSessions()
+	if err != nil {
+		logging.Errorf("Admin: failed to list sessions: %v", err)
+		http.Error(w, "Failed to read sessions", http.StatusInternalServerError)
+		return
+	}
+	h.renderSessionsPage(w, h.auth.csrfToken(w, r), sessions, current, r.URL.Query().Get("revoked") != "")
 }
 
-// handleAdminSettings shows the settings page
-func (h *Handler) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
-	h.renderSettingsPage(w, "")
+// handleAdminRevokeSession ends a session chosen on the sessions page
+func (h *Handler) handleAdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PostFormValue("id")
+	if _, ok := h.auth.GetSession(id); ok {
+		h.auth.DeleteSession(id)
+		log.Printf("admin: session %s… revoked from %s [request_id=%s]",
+			id[:8], GetClientIP(r), middleware.GetRequestID(r.Context()))
+		e := AuditEvent(r, audit.ActionSessionRevoked, true)
+		e.Detail = "session " + id[:8] + "…"
+		h.audit().Record(e)
+	}
+	http.Redirect(w, r, "/admin/sessions?revoked=1", http.StatusSeeOther)
 }
 
 // API Handlers
 
-func (h *Handler) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	status := map[string]interface{}{
-		"status":    "healthy",
-		"version":   h.version,
-		"commit":    h.commit,
-		"buildDate": h.buildDate,
-		"uptime":    time.Since(time.Now()).String(),
-		"memory": map[string]interface{}{
-			"alloc":      m.Alloc,
-			"totalAlloc": m.TotalAlloc,
-			"sys":        m.Sys,
-			"numGC":      m.NumGC,
-		},
-		"runtime": map[string]interface{}{
-			"goroutines": runtime.NumGoroutine(),
-			"cpus":       runtime.NumCPU(),
-			"goVersion":  runtime.Version(),
-		},
+func (h *Handler) handleAPIGetConfig(w http.ResponseWriter, r *http.Request) {
+	// Return safe subset of config (no sensitive data)
+	safe := map[string]interface{}{
+		"version": h.version,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	json.NewEncoder(w).Encode(safe)
 }
 
-func (h *Handler) handleAPIGetConfig(w http.ResponseWriter, r *http.Request) {
-	// Return safe subset of config (no sensitive data)
-	config := map[string]interface{}{
-		"version": h.version,
+func (h *Handler) handleAPIReload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	changes, err := config.Reload()
+	e := AuditEvent(r, audit.ActionConfigReload, err == nil)
+	e.Changes = changes
+	if err != nil {
+		e.Detail = err.Error()
+	}
+	h.audit().Record(e)
+	if err != nil {
+		logging.Errorf("Admin: config reload failed [request_id=%s]: %v", middleware.GetRequestID(r.Context()), err)
+		resp := map[string]interface{}{
+			"status":     "failed",
+			"error":      err.Error(),
+			"request_id": middleware.GetRequestID(r.Context()),
+		}
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			problems := make([]string, len(verr.Problems))
+			for i, p := range verr.Problems {
+				problems[i] = p.String()
+			}
+			resp["error"] = "invalid configuration"
+			resp["problems"] = problems
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if changes == nil {
+		changes = []config.Change{}
+	}
+	log.Printf("Admin: config reloaded via API, %d change(s) [request_id=%s]", len(changes), middleware.GetRequestID(r.Context()))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "reloaded",
+		"changes": changes,
+	})
+}
+
+// handleAPITokens lists tokens (GET) or creates one (POST). The token value
+// is only returned by the create call.
+func (h *Handler) handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.tokens.List()
+		if err != nil {
+			logging.Errorf("Admin: failed to list API tokens: %v", err)
+			writeAPIError(w, r, http.StatusInternalServerError, "Failed to read token store")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens})
+
+	case http.MethodPost:
+		var req struct {
+			Name        string   `json:"name"`
+			Permissions []string `json:"permissions"`
+			ExpiresIn   string   `json:"expires_in"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		ttl, err := ParseTTL(req.ExpiresIn)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		token, secret, err := h.tokens.Create(req.Name, req.Permissions, ttl)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Admin: created API token %s (%s) [request_id=%s]", token.ID, token.Name, middleware.GetRequestID(r.Context()))
+		e := AuditEvent(r, audit.ActionTokenCreated, true)
+		e.Detail = fmt.Sprintf("%s (%s) with %s", tokenActor(token), token.Name, strings.Join(token.Permissions, ", "))
+		h.audit().Record(e)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": secret, "info": token})
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
+}
 
+// handleAPIToken revokes a token (DELETE)
+func (h *Handler) handleAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.tokens.Revoke(id); err != nil {
+		h.writeTokenError(w, r, err)
+		return
+	}
+	log.Printf("Admin: revoked API token %s [request_id=%s]", id, middleware.GetRequestID(r.Context()))
+	e := AuditEvent(r, audit.ActionTokenRevoked, true)
+	e.Detail = "token:" + id
+	h.audit().Record(e)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(config)
+	json.NewEncoder(w).Encode(map[string]string{"status": "revoked", "id": id})
 }
 
-func (h *Handler) handleAPIReload(w http.ResponseWriter, r *http.Request) {
+// handleAPIRotateToken replaces a token's value (POST)
+func (h *Handler) handleAPIRotateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token, secret, err := h.tokens.Rotate(r.PathValue("id"))
+	if err != nil {
+		h.writeTokenError(w, r, err)
+		return
+	}
+	log.Printf("Admin: rotated API token %s (%s) [request_id=%s]", token.ID, token.Name, middleware.GetRequestID(r.Context()))
+	e := AuditEvent(r, audit.ActionTokenRotated, true)
+	e.Detail = fmt.Sprintf("%s (%s)", tokenActor(token), token.Name)
+	h.audit().Record(e)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "reloaded"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"token": secret, "info": token})
+}
+
+// writeTokenError maps token store errors to responses
+func (h *Handler) writeTokenError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrTokenNotFound) {
+		writeAPIError(w, r, http.StatusNotFound, "Token not found")
+		return
+	}
+	logging.Errorf("Admin: token store error: %v", err)
+	writeAPIError(w, r, http.StatusInternalServerError, "Failed to update token store")
 }
 
 // HTML Templates
 
-func (h *Handler) renderLoginPage(w http.ResponseWriter, errorMsg string) {
+func (h *Handler) renderLoginPage(w http.ResponseWriter, csrf, errorMsg string) {
 	tmpl := template.Must(template.New("login").Parse(loginTemplate))
 	tmpl.Execute(w, map[string]interface{}{
 		"Error": errorMsg,
+		"CSRF":  csrf,
 	})
 }
 
-func (h *Handler) renderDashboardPage(w http.ResponseWriter) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	tmpl := template.Must(template.New("dashboard").Parse(dashboardTemplate))
+func (h *Handler) renderTOTPPage(w http.ResponseWriter, csrf, errorMsg string) {
+	tmpl := template.Must(template.New("totp").Parse(totpTemplate))
 	tmpl.Execute(w, map[string]interface{}{
-		"Version":    h.version,
-		"Commit":     h.commit,
-		"BuildDate":  h.buildDate,
-		"MemAlloc":   fmt.Sprintf("%.2f MB", float64(m.Alloc)/1024/1024),
-		"Goroutines": runtime.NumGoroutine(),
+		"Error": errorMsg,
+		"CSRF":  csrf,
 	})
 }
 
-func (h *Handler) renderSettingsPage(w http.ResponseWriter, message string) {
-	tmpl := template.Must(template.New("settings").Parse(settingsTemplate))
+func (h *Handler) renderSessionsPage(w http.ResponseWriter, csrf string, sessions []*Session, current *Session, revoked bool) {
+	currentID := ""
+	if current != nil {
+		currentID = current.ID
+	}
+	tmpl := template.Must(template.New("sessions").Parse(sessionsTemplate))
 	tmpl.Execute(w, map[string]interface{}{
-		"Message": message,
+		"CSRF":      csrf,
+		"Sessions":  sessions,
+		"CurrentID": currentID,
+		"Revoked":   revoked,
 	})
 }
 
@@ -261,6 +698,7 @@ const loginTemplate = `<!DOCTYPE html>
         <h1>Admin Login</h1>
         {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
         <form method="POST" action="/admin/login">
+            <input type="hidden" name="csrf_token" value="{{.CSRF}}">
             <label for="username">Username</label>
             <input type="text" id="username" name="username" required autofocus>
             <label for="password">Password</label>
@@ -271,6 +709,84 @@ const loginTemplate = `<!DOCTYPE html>
 </body>
 </html>`
 
+const totpTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Two-Factor Authentication - GitMessages API</title>
+    <style>
+        :root {
+            --bg-color: #282a36;
+            --fg-color: #f8f8f2;
+            --accent: #bd93f9;
+            --red: #ff5555;
+            --green: #50fa7b;
+            --input-bg: #44475a;
+        }
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: var(--bg-color);
+            color: var(--fg-color);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+        }
+        .login-container {
+            background: var(--input-bg);
+            padding: 2rem;
+            border-radius: 8px;
+            width: 100%;
+            max-width: 400px;
+            box-shadow: 0 4px 6px rgba(0,0,0,0.3);
+        }
+        h1 { text-align: center; margin-bottom: 1.5rem; color: var(--accent); }
+        .error { background: var(--red); color: #fff; padding: 0.75rem; border-radius: 4px; margin-bottom: 1rem; }
+        label { display: block; margin-bottom: 0.5rem; font-weight: 500; }
+        input[type="text"], input[type="password"] {
+            width: 100%;
+            padding: 0.75rem;
+            border: none;
+            border-radius: 4px;
+            background: var(--bg-color);
+            color: var(--fg-color);
+            margin-bottom: 1rem;
+            font-size: 1rem;
+        }
+        input:focus { outline: 2px solid var(--accent); }
+        button {
+            width: 100%;
+            padding: 0.75rem;
+            border: none;
+            border-radius: 4px;
+            background: var(--accent);
+            color: var(--bg-color);
+            font-size: 1rem;
+            font-weight: 600;
+            cursor: pointer;
+            transition: opacity 0.2s;
+        }
+        button:hover { opacity: 0.9; }
+        .hint { font-size: 0.85rem; opacity: 0.8; margin: -0.5rem 0 1rem; }
+    </style>
+</head>
+<body>
+    <div class="login-container">
+        <h1>Two-Factor Authentication</h1>
+        {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+        <form method="POST" action="/admin/login/2fa">
+            <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+            <label for="code">Authentication code</label>
+            <input type="text" id="code" name="code" inputmode="numeric" autocomplete="one-time-code" required autofocus>
+            <p class="hint">Enter the code from your authenticator app, or a recovery code.</p>
+            <button type="submit">Verify</button>
+        </form>
+    </div>
+</body>
+</html>`
+
 const dashboardTemplate = `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -283,6 +799,8 @@ const dashboardTemplate = `<!DOCTYPE html>
             --fg-color: #f8f8f2;
             --accent: #bd93f9;
             --card-bg: #44475a;
+            --green: #50fa7b;
+            --red: #ff5555;
         }
         * { box-sizing: border-box; margin: 0; padding: 0; }
         body {
@@ -301,15 +819,28 @@ const dashboardTemplate = `<!DOCTYPE html>
         .navbar h1 { color: var(--accent); font-size: 1.5rem; }
         .navbar a { color: var(--fg-color); text-decoration: none; margin-left: 1rem; }
         .navbar a:hover { color: var(--accent); }
+        .navbar .logout { display: inline; }
+        .navbar .logout button { background: none; border: none; color: var(--fg-color); font: inherit; margin-left: 1rem; cursor: pointer; }
+        .navbar .logout button:hover { color: var(--accent); }
         .container { max-width: 1200px; margin: 2rem auto; padding: 0 1rem; }
-        .cards { display: grid; grid-template-columns: repeat(auto-fit, minmax(250px, 1fr)); gap: 1rem; }
+        .cards { display: grid; grid-template-columns: repeat(auto-fit, minmax(250px, 1fr)); gap: 1rem; margin-bottom: 1rem; }
         .card {
             background: var(--card-bg);
             padding: 1.5rem;
             border-radius: 8px;
         }
+        .card h2 { color: var(--accent); margin-bottom: 1rem; }
         .card h3 { color: var(--accent); margin-bottom: 0.5rem; }
         .card p { font-size: 1.5rem; font-weight: bold; }
+        .card small { display: block; margin-top: 0.25rem; opacity: 0.7; }
+        .progress { height: 0.5rem; background: var(--bg-color); border-radius: 4px; margin-top: 0.5rem; overflow: hidden; }
+        .progress div { height: 100%; width: 0; background: var(--accent); }
+        .tables { display: grid; grid-template-columns: repeat(auto-fit, minmax(450px, 1fr)); gap: 1rem; }
+        table { width: 100%; border-collapse: collapse; }
+        th, td { text-align: left; padding: 0.5rem; border-bottom: 1px solid var(--bg-color); }
+        .ok { color: var(--green); }
+        .failed { color: var(--red); }
+        .live { font-size: 0.85rem; opacity: 0.7; margin-bottom: 1rem; }
     </style>
 </head>
 <body>
@@ -318,32 +849,145 @@ const dashboardTemplate = `<!DOCTYPE html>
         <div>
             <a href="/admin/dashboard">Dashboard</a>
             <a href="/admin/settings">Settings</a>
-            <a href="/admin/logout">Logout</a>
+            <a href="/admin/sessions">Sessions</a>
+            <a href="/admin/audit">Audit</a>
+            <form class="logout" method="POST" action="/admin/logout">
+                <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+                <button type="submit">Logout</button>
+            </form>
         </div>
     </nav>
     <div class="container">
+        <p class="live" id="live">Connecting… (updates every {{.Refresh}}s)</p>
         <div class="cards">
             <div class="card">
-                <h3>Version</h3>
-                <p>{{.Version}}</p>
+                <h3>Uptime</h3>
+                <p id="uptime">-</p>
+                <small>Since {{.StartedAt}}</small>
+            </div>
+            <div class="card">
+                <h3>Health</h3>
+                <p id="health">-</p>
+                <small id="health-checks">-</small>
+            </div>
+            <div class="card">
+                <h3>Requests</h3>
+                <p id="rate">-</p>
+                <small id="requests">-</small>
+            </div>
+            <div class="card">
+                <h3>Error Rate (5m)</h3>
+                <p id="error-rate">-</p>
+                <small id="errors">-</small>
+            </div>
+            <div class="card">
+                <h3>Messages Served</h3>
+                <p id="served">-</p>
+                <small id="cycle">-</small>
+                <div class="progress"><div id="cycle-progress"></div></div>
+            </div>
+            <div class="card">
+                <h3>Active Sessions</h3>
+                <p id="sessions">-</p>
             </div>
             <div class="card">
                 <h3>Memory Usage</h3>
-                <p>{{.MemAlloc}}</p>
+                <p id="memory">-</p>
+                <small id="goroutines">-</small>
+            </div>
+            <div class="card">
+                <h3>Version</h3>
+                <p>{{.Version}}</p>
+                <small>{{.Commit}} built {{.BuildDate}}</small>
             </div>
+        </div>
+        <div class="tables">
             <div class="card">
-                <h3>Goroutines</h3>
-                <p>{{.Goroutines}}</p>
+                <h2>Top Endpoints</h2>
+                <table>
+                    <thead><tr><th>Endpoint</th><th>Requests</th><th>Errors</th><th>Avg (ms)</th></tr></thead>
+                    <tbody id="endpoints"></tbody>
+                </table>
             </div>
             <div class="card">
-                <h3>Build Date</h3>
-                <p>{{.BuildDate}}</p>
+                <h2>Recent Activity</h2>
+                <table>
+                    <thead><tr><th>Time</th><th>Action</th><th>Actor</th><th>Result</th></tr></thead>
+                    <tbody id="audit"></tbody>
+                </table>
             </div>
         </div>
     </div>
+    <script>
+        function set(id, text) { document.getElementById(id).textContent = text; }
+        function percent(x) { return (100 * x).toFixed(1) + '%'; }
+        function bytes(n) {
+            var units = ['B', 'KB', 'MB', 'GB'];
+            var i = 0;
+            while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+            return n.toFixed(i ? 1 : 0) + ' ' + units[i];
+        }
+        function fill(id, rows, empty) {
+            var body = document.getElementById(id);
+            body.replaceChildren();
+            if (!rows.length) rows = [[empty]];
+            rows.forEach(function (cells) {
+                var tr = document.createElement('tr');
+                cells.forEach(function (cell) {
+                    var td = document.createElement('td');
+                    if (cell instanceof Node) td.appendChild(cell); else td.textContent = cell;
+                    tr.appendChild(td);
+                });
+                body.appendChild(tr);
+            });
+        }
+        function result(ok) {
+            var span = document.createElement('span');
+            span.className = ok ? 'ok' : 'failed';
+            span.textContent = ok ? 'ok' : 'failed';
+            return span;
+        }
+
+        function update(s) {
+            set('uptime', s.uptime);
+            set('memory', bytes(s.memory.alloc));
+            set('goroutines', s.runtime.goroutines + ' goroutines');
+            set('sessions', s.sessions ? s.sessions.active : '-');
+            set('health', s.status);
+            if (s.health) {
+                var failed = s.health.checks.filter(function (c) { return c.status !== 'ok'; });
+                set('health-checks', failed.length ? failed.map(function (c) {
+                    return c.name + ': ' + (c.message || c.status);
+                }).join(', ') : s.health.checks.length + ' checks passing');
+            }
+            if (s.requests) {
+                var r = s.requests;
+                set('rate', r.rate_1m.toFixed(2) + '/s');
+                set('requests', r.requests + ' total, ' + r.rate_5m.toFixed(2) + '/s over 5m');
+                set('error-rate', percent(r.error_rate_5m));
+                set('errors', r.server_errors + ' server, ' + r.client_errors + ' client errors');
+                fill('endpoints', r.top_endpoints.map(function (e) {
+                    return [e.endpoint, e.requests, e.errors, e.avg_latency_ms.toFixed(1)];
+                }), 'No requests yet');
+            }
+            if (s.messages) {
+                var m = s.messages;
+                set('served', m.served);
+                set('cycle', 'Cycle ' + m.cycle + ': ' + m.used_in_cycle + ' of ' + m.total);
+                document.getElementById('cycle-progress').style.width = m.progress + '%';
+            }
+            fill('audit', (s.recent_audit || []).map(function (e) {
+                return [new Date(e.time).toLocaleString(), e.action, e.actor, result(e.success)];
+            }), 'No events');
+            set('live', 'Updated ' + new Date().toLocaleTimeString());
+        }
+
+        var events = new EventSource('/admin/events');
+        events.addEventListener('status', function (e) { update(JSON.parse(e.data)); });
+        events.onerror = function () { set('live', 'Disconnected, retrying…'); };
+    </script>
 </body>
 </html>`
-
 const settingsTemplate = `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -357,6 +1001,8 @@ const settingsTemplate = `<!DOCTYPE html>
             --accent: #bd93f9;
             --card-bg: #44475a;
             --green: #50fa7b;
+            --red: #ff5555;
+            --orange: #ffb86c;
         }
         * { box-sizing: border-box; margin: 0; padding: 0; }
         body {
@@ -375,6 +1021,9 @@ const settingsTemplate = `<!DOCTYPE html>
         .navbar h1 { color: var(--accent); font-size: 1.5rem; }
         .navbar a { color: var(--fg-color); text-decoration: none; margin-left: 1rem; }
         .navbar a:hover { color: var(--accent); }
+        .navbar .logout { display: inline; }
+        .navbar .logout button { background: none; border: none; color: var(--fg-color); font: inherit; margin-left: 1rem; cursor: pointer; }
+        .navbar .logout button:hover { color: var(--accent); }
         .container { max-width: 800px; margin: 2rem auto; padding: 0 1rem; }
         .message { background: var(--green); color: #000; padding: 1rem; border-radius: 4px; margin-bottom: 1rem; }
         .card {
@@ -383,6 +1032,32 @@ const settingsTemplate = `<!DOCTYPE html>
             border-radius: 8px;
         }
         .card h2 { color: var(--accent); margin-bottom: 1rem; }
+        .card + .card { margin-top: 1rem; }
+        .error { background: var(--red); color: #fff; padding: 1rem; border-radius: 4px; margin-bottom: 1rem; }
+        .error li { margin-left: 1rem; }
+        .field { display: grid; grid-template-columns: 200px 1fr; gap: 0.5rem 1rem; align-items: start; margin-bottom: 0.75rem; }
+        .field label { padding-top: 0.4rem; }
+        .field input[type=text], .field input[type=number], .field select, .field textarea {
+            width: 100%;
+            padding: 0.4rem;
+            border: 1px solid var(--bg-color);
+            border-radius: 4px;
+            background: var(--bg-color);
+            color: var(--fg-color);
+            font: inherit;
+        }
+        .field input[type=checkbox] { margin-top: 0.6rem; }
+        .field textarea { min-height: 4.5rem; }
+        .hint { grid-column: 2; font-size: 0.85rem; opacity: 0.7; margin-top: -0.25rem; }
+        .locked { color: var(--orange); }
+        table { width: 100%; border-collapse: collapse; }
+        th, td { text-align: left; padding: 0.5rem; border-bottom: 1px solid var(--bg-color); vertical-align: top; }
+        td.old { color: var(--red); font-family: monospace; }
+        td.new { color: var(--green); font-family: monospace; }
+        .actions { display: flex; gap: 0.5rem; margin-top: 1rem; }
+        .actions button { border: none; border-radius: 4px; padding: 0.5rem 1.25rem; cursor: pointer; font: inherit; }
+        .preview { background: var(--accent); color: var(--bg-color); }
+        .save { background: var(--green); color: #000; }
     </style>
 </head>
 <body>
@@ -391,14 +1066,141 @@ const settingsTemplate = `<!DOCTYPE html>
         <div>
             <a href="/admin/dashboard">Dashboard</a>
             <a href="/admin/settings">Settings</a>
-            <a href="/admin/logout">Logout</a>
+            <a href="/admin/sessions">Sessions</a>
+            <a href="/admin/audit">Audit</a>
+            <form class="logout" method="POST" action="/admin/logout">
+                <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+                <button type="submit">Logout</button>
+            </form>
         </div>
     </nav>
     <div class="container">
         {{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+        {{if .Problems}}<div class="error">The settings were not saved:<ul>{{range .Problems}}<li>{{.}}</li>{{end}}</ul></div>{{end}}
+        <form method="POST" action="/admin/settings">
+            <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+            {{if .Changes}}
+            <div class="card">
+                <h2>{{if .Preview}}Changes to review{{else}}Applied changes{{end}}</h2>
+                <table>
+                    <tr><th>Setting</th><th>Current</th><th>New</th></tr>
+                    {{range .Changes}}<tr><td>{{.Key}}</td><td class="old">{{.Old}}</td><td class="new">{{.New}}</td></tr>{{end}}
+                </table>
+                {{if .Restart}}<p class="locked">Takes effect after a restart: {{range $i, $k := .Restart}}{{if $i}}, {{end}}{{$k}}{{end}}</p>{{end}}
+                {{if .Preview}}
+                <input type="hidden" name="preview" value="{{.Preview}}">
+                <div class="actions"><button type="submit" name="action" value="save" class="save">Save and apply</button></div>
+                {{end}}
+            </div>
+            {{end}}
+            {{range .Sections}}
+            <div class="card">
+                <h2>{{.Title}}</h2>
+                {{range .Fields}}
+                <div class="field">
+                    <label for="{{.Key}}">{{.Label}}</label>
+                    {{if eq .Kind "bool"}}<input type="checkbox" id="{{.Key}}" name="{{.Key}}" value="true"{{if .Checked}} checked{{end}}{{if .LockedBy}} disabled{{end}}>
+                    {{else if eq .Kind "select"}}<select id="{{.Key}}" name="{{.Key}}"{{if .LockedBy}} disabled{{end}}>{{$v := .Value}}{{range .Options}}<option{{if eq . $v}} selected{{end}}>{{.}}</option>{{end}}</select>
+                    {{else if eq .Kind "lines"}}<textarea id="{{.Key}}" name="{{.Key}}"{{if .LockedBy}} disabled{{end}}>{{.Value}}</textarea>
+                    {{else}}<input type="{{if eq .Kind "number"}}number{{else}}text{{end}}" id="{{.Key}}" name="{{.Key}}" value="{{.Value}}"{{if .LockedBy}} disabled{{end}}>
+                    {{end}}
+                    <div class="hint">{{.Key}}{{if .Help}} · {{.Help}}{{end}}{{if .Restart}} · needs restart{{end}}{{if .LockedBy}} · <span class="locked">set by {{.LockedBy}}</span>{{end}}</div>
+                </div>
+                {{end}}
+            </div>
+            {{end}}
+            <div class="actions"><button type="submit" name="action" value="preview" class="preview">Preview changes</button></div>
+        </form>
+    </div>
+</body>
+</html>`
+
+const sessionsTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Sessions - GitMessages API</title>
+    <style>
+        :root {
+            --bg-color: #282a36;
+            --fg-color: #f8f8f2;
+            --accent: #bd93f9;
+            --card-bg: #44475a;
+            --green: #50fa7b;
+        }
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: var(--bg-color);
+            color: var(--fg-color);
+            min-height: 100vh;
+        }
+        .navbar {
+            background: var(--card-bg);
+            padding: 1rem 2rem;
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+        }
+        .navbar h1 { color: var(--accent); font-size: 1.5rem; }
+        .navbar a { color: var(--fg-color); text-decoration: none; margin-left: 1rem; }
+        .navbar a:hover { color: var(--accent); }
+        .navbar .logout { display: inline; }
+        .navbar .logout button { background: none; border: none; color: var(--fg-color); font: inherit; margin-left: 1rem; cursor: pointer; }
+        .navbar .logout button:hover { color: var(--accent); }
+        .container { max-width: 1200px; margin: 2rem auto; padding: 0 1rem; }
+        .message { background: var(--green); color: #000; padding: 1rem; border-radius: 4px; margin-bottom: 1rem; }
+        .card {
+            background: var(--card-bg);
+            padding: 1.5rem;
+            border-radius: 8px;
+        }
+        .card h2 { color: var(--accent); margin-bottom: 1rem; }
+        table { width: 100%; border-collapse: collapse; }
+        th, td { text-align: left; padding: 0.5rem; border-bottom: 1px solid var(--bg-color); }
+        td.ua { max-width: 220px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+        .revoke { background: #ff5555; color: #fff; border: none; border-radius: 4px; padding: 0.25rem 0.75rem; cursor: pointer; }
+    </style>
+</head>
+<body>
+    <nav class="navbar">
+        <h1>GitMessages API Admin</h1>
+        <div>
+            <a href="/admin/dashboard">Dashboard</a>
+            <a href="/admin/settings">Settings</a>
+            <a href="/admin/sessions">Sessions</a>
+            <a href="/admin/audit">Audit</a>
+            <form class="logout" method="POST" action="/admin/logout">
+                <input type="hidden" name="csrf_token" value="{{.CSRF}}">
+                <button type="submit">Logout</button>
+            </form>
+        </div>
+    </nav>
+    <div class="container">
+        {{if .Revoked}}<div class="message">Session revoked</div>{{end}}
         <div class="card">
-            <h2>Settings</h2>
-            <p>Settings configuration coming soon.</p>
+            <h2>Active Sessions</h2>
+            <table>
+                <tr><th>User</th><th>IP</th><th>Browser</th><th>Created</th><th>Last seen</th><th>Expires</th><th></th></tr>
+                {{range .Sessions}}
+                <tr>
+                    <td>{{.Username}}</td>
+                    <td>{{.IP}}</td>
+                    <td class="ua" title="{{.UserAgent}}">{{.UserAgent}}</td>
+                    <td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td>
+                    <td>{{.LastSeen.Format "2006-01-02 15:04"}}</td>
+                    <td>{{.ExpiresAt.Format "2006-01-02 15:04"}}</td>
+                    <td>{{if eq .ID $.CurrentID}}current{{else}}
+                        <form method="POST" action="/admin/sessions/revoke">
+                            <input type="hidden" name="csrf_token" value="{{$.CSRF}}">
+                            <input type="hidden" name="id" value="{{.ID}}">
+                            <button type="submit" class="revoke">Revoke</button>
+                        </form>{{end}}
+                    </td>
+                </tr>
+                {{end}}
+            </table>
         </div>
     </div>
 </body>
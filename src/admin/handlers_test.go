@@ -0,0 +1,355 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/audit"
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/health"
+)
+
+// newTestHandler returns a handler with its routes on a fresh mux, backed
+// by a default config file and token store in a temporary directory
+func newTestHandler(t *testing.T) (*Handler, *http.ServeMux) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := config.Load(filepath.Join(dir, "server.yml")); err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	h := NewHandler("admin", "secret", "", 3600, false, dir, "test", "none", "today")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return h, mux
+}
+
+// newToken creates a token with scopes and returns its secret
+func newToken(t *testing.T, h *Handler, scopes ...string) (*APIToken, string) {
+	t.Helper()
+	token, secret, err := h.tokens.Create("test", scopes, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return token, secret
+}
+
+// serve runs req through mux and checks it matched pattern
+func serve(t *testing.T, mux *http.ServeMux, req *http.Request, pattern string) *httptest.ResponseRecorder {
+	t.Helper()
+	if _, got := mux.Handler(req); got != pattern {
+		t.Fatalf("%s %s matched %q, want %q", req.Method, req.URL.Path, got, pattern)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// tokenRoutes are the admin API routes with the scope each one needs. In
+// paths, {id} is replaced by the ID of a token created for the request.
+var tokenRoutes = []struct {
+	pattern string
+	method  string
+	path    string
+	body    string
+	scope   string
+	want    int
+}{
+	{"/api/v1/admin/status", "GET", "/api/v1/admin/status", "", ScopeStatusRead, http.StatusOK},
+	{"/api/v1/admin/config", "GET", "/api/v1/admin/config", "", ScopeConfigRead, http.StatusOK},
+	{"PATCH /api/v1/admin/config", "PATCH", "/api/v1/admin/config?dry_run=true", `{"web-ui.theme":"light"}`, ScopeConfigWrite, http.StatusOK},
+	{"/api/v1/admin/reload", "POST", "/api/v1/admin/reload", "", ScopeReload, http.StatusOK},
+	{"/api/v1/admin/audit", "GET", "/api/v1/admin/audit", "", ScopeAuditRead, http.StatusOK},
+	{"/api/v1/admin/tokens", "GET", "/api/v1/admin/tokens", "", ScopeTokensAdmin, http.StatusOK},
+	{"/api/v1/admin/tokens", "POST", "/api/v1/admin/tokens", `{"name":"new","permissions":["status:read"]}`, ScopeTokensAdmin, http.StatusCreated},
+	{"/api/v1/admin/tokens/{id}", "DELETE", "/api/v1/admin/tokens/{id}", "", ScopeTokensAdmin, http.StatusOK},
+	{"/api/v1/admin/tokens/{id}/rotate", "POST", "/api/v1/admin/tokens/{id}/rotate", "", ScopeTokensAdmin, http.StatusOK},
+}
+
+func TestTokenRoutes(t *testing.T) {
+	h, mux := newTestHandler(t)
+
+	for _, tc := range tokenRoutes {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			request := func(secret string) *http.Request {
+				target, _ := newToken(t, h, ScopeStatusRead)
+				path := strings.ReplaceAll(tc.path, "{id}", target.ID)
+				req := httptest.NewRequest(tc.method, path, strings.NewReader(tc.body))
+				if secret != "" {
+					req.Header.Set("Authorization", "Bearer "+secret)
+				}
+				return req
+			}
+
+			t.Run("no token", func(t *testing.T) {
+				rec := serve(t, mux, request(""), tc.pattern)
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("status = %d, want 401", rec.Code)
+				}
+			})
+
+			t.Run("wrong scope", func(t *testing.T) {
+				other := ScopeStatusRead
+				if tc.scope == ScopeStatusRead {
+					other = ScopeConfigRead
+				}
+				_, secret := newToken(t, h, other)
+				rec := serve(t, mux, request(secret), tc.pattern)
+				if rec.Code != http.StatusForbidden {
+					t.Fatalf("status = %d, want 403", rec.Code)
+				}
+				var body map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("invalid JSON: %v", err)
+				}
+				if body["missing_scope"] != tc.scope {
+					t.Errorf("missing_scope = %q, want %q", body["missing_scope"], tc.scope)
+				}
+			})
+
+			t.Run("scope", func(t *testing.T) {
+				_, secret := newToken(t, h, tc.scope)
+				rec := serve(t, mux, request(secret), tc.pattern)
+				if rec.Code != tc.want {
+					t.Errorf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+				}
+			})
+		})
+	}
+}
+
+func TestTokenAllScope(t *testing.T) {
+	h, mux := newTestHandler(t)
+	_, secret := newToken(t, h, ScopeAll)
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/audit", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	if rec := serve(t, mux, req, "/api/v1/admin/audit"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+// sessionRoutes need an admin session; requests carry a CSRF token for
+// the POSTs
+var sessionRoutes = []struct {
+	pattern  string
+	method   string
+	path     string
+	want     int
+	location string
+}{
+	{"/admin/dashboard", "GET", "/admin/dashboard", http.StatusOK, ""},
+	{"/admin/events", "GET", "/admin/events", http.StatusOK, ""},
+	{"/admin/settings", "GET", "/admin/settings", http.StatusOK, ""},
+	{"/admin/sessions", "GET", "/admin/sessions", http.StatusOK, ""},
+	{"/admin/sessions/revoke", "POST", "/admin/sessions/revoke", http.StatusSeeOther, "/admin/sessions?revoked=1"},
+	{"/admin/audit", "GET", "/admin/audit", http.StatusOK, ""},
+}
+
+func TestSessionRoutes(t *testing.T) {
+	h, mux := newTestHandler(t)
+	_, cookie := h.auth.CreateSession("admin", "192.0.2.1", "test")
+	const csrf = "0123456789012345678901234567890123456789012"
+
+	for _, tc := range sessionRoutes {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			request := func(withSession bool) *http.Request {
+				req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("csrf_token="+csrf))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: csrf})
+				if withSession {
+					req.AddCookie(&http.Cookie{Name: "admin_session", Value: cookie})
+				}
+				// The event stream only ends with the request
+				ctx, cancel := context.WithTimeout(req.Context(), 100*time.Millisecond)
+				t.Cleanup(cancel)
+				return req.WithContext(ctx)
+			}
+
+			t.Run("no session", func(t *testing.T) {
+				rec := serve(t, mux, request(false), tc.pattern)
+				if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin" {
+					t.Errorf("got %d to %q, want redirect to /admin", rec.Code, rec.Header().Get("Location"))
+				}
+			})
+
+			t.Run("session", func(t *testing.T) {
+				rec := serve(t, mux, request(true), tc.pattern)
+				if rec.Code != tc.want {
+					t.Errorf("status = %d, want %d", rec.Code, tc.want)
+				}
+				if tc.location != "" && rec.Header().Get("Location") != tc.location {
+					t.Errorf("Location = %q, want %q", rec.Header().Get("Location"), tc.location)
+				}
+			})
+		})
+	}
+}
+
+// publicRoutes are reachable without a session; their POSTs need a CSRF
+// token
+var publicRoutes = []struct {
+	pattern string
+	method  string
+	path    string
+	want    int
+}{
+	{"/admin", "GET", "/admin", http.StatusOK},
+	{"/admin/login", "POST", "/admin/login", http.StatusForbidden},
+	{"/admin/login/2fa", "POST", "/admin/login/2fa", http.StatusForbidden},
+	{"/admin/logout", "POST", "/admin/logout", http.StatusForbidden},
+}
+
+func TestPublicRoutes(t *testing.T) {
+	_, mux := newTestHandler(t)
+	for _, tc := range publicRoutes {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("username=admin&password=secret"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if rec := serve(t, mux, req, tc.pattern); rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+// TestRoutesCovered fails when RegisterRoutes gains a route the tables
+// above do not exercise
+func TestRoutesCovered(t *testing.T) {
+	tested := map[string]bool{}
+	for _, r := range tokenRoutes {
+		tested[r.pattern] = true
+	}
+	for _, r := range sessionRoutes {
+		tested[r.pattern] = true
+	}
+	for _, r := range publicRoutes {
+		tested[r.pattern] = true
+	}
+
+	h, _ := newTestHandler(t)
+	mux := &recordingMux{ServeMux: http.NewServeMux()}
+	h.registerRoutes(mux)
+	for _, pattern := range mux.patterns {
+		if !tested[pattern] {
+			t.Errorf("route %q has no test", pattern)
+		}
+	}
+}
+
+// recordingMux remembers the patterns registered on it
+type recordingMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (m *recordingMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.HandleFunc(pattern, handler)
+}
+
+func TestTokenDeniedAuditLimited(t *testing.T) {
+	h, mux := newTestHandler(t)
+	auditLog, err := audit.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("audit.Open: %v", err)
+	}
+	defer auditLog.Close()
+	h.SetAuditLog(auditLog)
+
+	for i := 0; i < 50; i++ {
+		req := httptest.NewRequest("GET", "/api/v1/admin/status", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		if rec := serve(t, mux, req, "/api/v1/admin/status"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", rec.Code)
+		}
+	}
+	events, err := auditLog.Search(audit.Query{Action: audit.ActionTokenDenied})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("%d token.denied events recorded, want 1 per client and minute", len(events))
+	}
+}
+
+func TestStatusReportsHealthChecks(t *testing.T) {
+	h, mux := newTestHandler(t)
+	_, secret := newToken(t, h, ScopeStatusRead)
+	status := func() map[string]interface{} {
+		req := httptest.NewRequest("GET", "/api/v1/admin/status", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		var body map[string]interface{}
+		if err := json.Unmarshal(serve(t, mux, req, "/api/v1/admin/status").Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return body
+	}
+
+	if got := status()["status"]; got != "unknown" {
+		t.Errorf("status without checks = %v, want unknown", got)
+	}
+
+	checks := health.New()
+	checks.Register("disk", false, func(ctx context.Context) error { return errors.New("disk almost full") })
+	h.SetHealthCheck(checks.Run)
+	body := status()
+	if body["status"] != health.Degraded {
+		t.Errorf("status = %v, want %s", body["status"], health.Degraded)
+	}
+	if !strings.Contains(fmt.Sprint(body["health"]), "disk almost full") {
+		t.Errorf("health = %v, want the failed check with its message", body["health"])
+	}
+}
+
+func TestTokenUsedAuditLimitsReads(t *testing.T) {
+	h, mux := newTestHandler(t)
+	auditLog, err := audit.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("audit.Open: %v", err)
+	}
+	defer auditLog.Close()
+	h.SetAuditLog(auditLog)
+	_, secret := newToken(t, h, ScopeAll)
+
+	request := func(method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		if rec := serve(t, mux, req, path); rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d, want 200", method, path, rec.Code)
+		}
+	}
+	// Reads such as scrapes are logged once a minute per token and route
+	for i := 0; i < 20; i++ {
+		request("GET", "/api/v1/admin/status")
+		request("GET", "/api/v1/admin/config")
+	}
+	// Every change is logged
+	for i := 0; i < 3; i++ {
+		request("POST", "/api/v1/admin/reload")
+	}
+
+	events, err := auditLog.Search(audit.Query{Action: audit.ActionTokenUsed})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	count := map[string]int{}
+	for _, e := range events {
+		count[e.Detail]++
+	}
+	want := map[string]int{
+		"GET /api/v1/admin/status":  1,
+		"GET /api/v1/admin/config":  1,
+		"POST /api/v1/admin/reload": 3,
+	}
+	if fmt.Sprint(count) != fmt.Sprint(want) {
+		t.Errorf("token.used events = %v, want %v", count, want)
+	}
+}
@@ -0,0 +1,239 @@
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// maxLockoutEvents is the number of recent lockouts kept for the status API
+const maxLockoutEvents = 50
+
+// attemptTimeout bounds how long a reserved attempt blocks others, in case
+// it is never ended
+const attemptTimeout = time.Minute
+
+// LockoutEvent records a client IP being locked out
+type LockoutEvent struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Key      string    `json:"key"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+// loginAttempts counts recent login failures for one IP or username;
+// reserved is set while an attempt is being checked
+type loginAttempts struct {
+	failures    int
+	first       time.Time
+	last        time.Time
+	lockedUntil time.Time
+	reserved    time.Time
+}
+
+// inFlight reports whether an attempt is being checked
+func (a *loginAttempts) inFlight(now time.Time) bool {
+	return !a.reserved.IsZero() && now.Sub(a.reserved) < attemptTimeout
+}
+
+// LoginGuard throttles admin logins per client IP and per username
+// according to a config.LockoutConfig. Client IPs are locked out after too
+// many failures; usernames only get a growing delay, so nobody can lock
+// the admin out by failing logins under their name.
+type LoginGuard struct {
+	mu     sync.Mutex
+	policy config.LockoutConfig
+	ips    map[string]*loginAttempts
+	users  map[string]*loginAttempts
+	events []LockoutEvent
+	now    func() time.Time
+}
+
+// NewLoginGuard creates a login guard with the given policy
+func NewLoginGuard(policy config.LockoutConfig) *LoginGuard {
+	return &LoginGuard{
+		policy: policy,
+		ips:    make(map[string]*loginAttempts),
+		users:  make(map[string]*loginAttempts),
+		now:    time.Now,
+	}
+}
+
+// SetPolicy replaces the lockout policy; counters are kept
+func (g *LoginGuard) SetPolicy(policy config.LockoutConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+}
+
+// Check reserves a login attempt for ip and username, or reports how long
+// the client has to wait. Only one attempt per IP and per username is
+// checked at a time; the caller ends it with Failure, Success or Release.
+func (g *LoginGuard) Check(ip, username string) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	attempts := g.attempts(ip, username)
+	var wait time.Duration
+	for _, a := range attempts {
+		if d := g.retryAt(a).Sub(now); d > wait {
+			wait = d
+		}
+		if a.inFlight(now) && wait < time.Second {
+			wait = time.Second
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, a := range attempts {
+		a.reserved = now
+	}
+	return 0, true
+}
+
+// Failure ends a reserved attempt as a failed login
+func (g *LoginGuard) Failure(ip, username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.fail(g.ips, "ip", ip, now, true)
+	if username != "" {
+		g.fail(g.users, "username", username, now, false)
+	}
+}
+
+// Success ends a reserved attempt and clears the failures of the IP and
+// username
+func (g *LoginGuard) Success(ip, username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.ips, ip)
+	delete(g.users, username)
+}
+
+// Release ends a reserved attempt without counting it, for a password
+// accepted while the second factor is still to come
+func (g *LoginGuard) Release(ip, username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, a := range g.attempts(ip, username) {
+		a.reserved = time.Time{}
+	}
+}
+
+// attempts returns the counters of ip and username, creating them. Callers
+// hold g.mu.
+func (g *LoginGuard) attempts(ip, username string) []*loginAttempts {
+	get := func(m map[string]*loginAttempts, key string) *loginAttempts {
+		a, ok := m[key]
+		if !ok {
+			a = &loginAttempts{}
+			m[key] = a
+		}
+		return a
+	}
+	attempts := []*loginAttempts{get(g.ips, ip)}
+	if username != "" {
+		attempts = append(attempts, get(g.users, username))
+	}
+	return attempts
+}
+
+// Status returns current lockouts and recent lockout events
+func (g *LoginGuard) Status() interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	keys := func(m map[string]*loginAttempts, match func(a *loginAttempts) bool) []string {
+		keys := []string{}
+		for k, a := range m {
+			if match(a) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	events := make([]LockoutEvent, len(g.events))
+	copy(events, g.events)
+
+	return map[string]interface{}{
+		"locked_ips": keys(g.ips, func(a *loginAttempts) bool {
+			return now.Before(a.lockedUntil)
+		}),
+		"delayed_usernames": keys(g.users, func(a *loginAttempts) bool {
+			return now.Before(g.retryAt(a))
+		}),
+		"lockouts": events,
+	}
+}
+
+// fail counts a failure in m, ending its reserved attempt, and with lock
+// set locks key out once the policy's limit is reached. Callers hold g.mu.
+func (g *LoginGuard) fail(m map[string]*loginAttempts, kind, key string, now time.Time, lock bool) {
+	window := time.Duration(g.policy.Window) * time.Second
+	a, ok := m[key]
+	if !ok || (now.After(a.lockedUntil) && now.Sub(a.first) > window) {
+		a = &loginAttempts{first: now}
+		m[key] = a
+	}
+	a.failures++
+	a.last = now
+	a.reserved = time.Time{}
+
+	if lock && g.policy.MaxFailures > 0 && a.failures >= g.policy.MaxFailures && now.After(a.lockedUntil) {
+		a.lockedUntil = now.Add(time.Duration(g.policy.Duration) * time.Second)
+		logging.Warnf("admin: locked out %s %q until %s after %d failed logins",
+			kind, key, a.lockedUntil.Format(time.RFC3339), a.failures)
+
+		g.events = append(g.events, LockoutEvent{Time: now, Kind: kind, Key: key, Failures: a.failures, Until: a.lockedUntil})
+		if len(g.events) > maxLockoutEvents {
+			g.events = g.events[len(g.events)-maxLockoutEvents:]
+		}
+	}
+}
+
+// retryAt returns when the next attempt is allowed: after the lockout, or
+// after a delay that doubles with each failure. Callers hold g.mu.
+func (g *LoginGuard) retryAt(a *loginAttempts) time.Time {
+	if a.lockedUntil.After(a.last) {
+		return a.lockedUntil
+	}
+	if a.failures == 0 || g.policy.BaseDelay <= 0 {
+		return a.last
+	}
+
+	delay := time.Duration(g.policy.BaseDelay) * time.Second
+	limit := time.Duration(g.policy.MaxDelay) * time.Second
+	for i := 1; i < a.failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if limit > 0 && delay > limit {
+		delay = limit
+	}
+	return a.last.Add(delay)
+}
+
+// cleanup forgets counters that can no longer block anyone
+func (g *LoginGuard) cleanup() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	window := time.Duration(g.policy.Window) * time.Second
+	for _, m := range []map[string]*loginAttempts{g.ips, g.users} {
+		for k, a := range m {
+			if !a.inFlight(now) && now.After(a.lockedUntil) && now.After(g.retryAt(a)) && now.Sub(a.first) > window {
+				delete(m, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/config"
+)
+
+// newTestGuard returns a guard with the default policy and a clock that
+// only moves when advance is called
+func newTestGuard() (*LoginGuard, func(time.Duration)) {
+	g := NewLoginGuard(config.DefaultConfig().Server.Admin.Lockout)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	return g, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCheckReservesAttempt(t *testing.T) {
+	g, _ := newTestGuard()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := g.Check("192.0.2.1", "admin"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 1 {
+		t.Fatalf("%d parallel attempts allowed, want 1", allowed)
+	}
+
+	// The same username from another IP waits for the attempt too
+	if _, ok := g.Check("192.0.2.2", "admin"); ok {
+		t.Error("attempt for a username in flight allowed")
+	}
+	g.Release("192.0.2.1", "admin")
+	if _, ok := g.Check("192.0.2.2", "admin"); !ok {
+		t.Error("attempt refused after release")
+	}
+}
+
+func TestCheckReservationExpires(t *testing.T) {
+	g, advance := newTestGuard()
+	if _, ok := g.Check("192.0.2.1", "admin"); !ok {
+		t.Fatal("first attempt refused")
+	}
+	advance(attemptTimeout)
+	if _, ok := g.Check("192.0.2.1", "admin"); !ok {
+		t.Error("attempt that was never ended still blocks")
+	}
+}
+
+func TestFailureLocksOutIP(t *testing.T) {
+	g, advance := newTestGuard()
+	policy := config.DefaultConfig().Server.Admin.Lockout
+
+	for i := 0; i < policy.MaxFailures; i++ {
+		wait, ok := g.Check("192.0.2.1", "admin")
+		if !ok {
+			advance(wait)
+			if _, ok = g.Check("192.0.2.1", "admin"); !ok {
+				t.Fatalf("attempt %d refused after waiting %s", i+1, wait)
+			}
+		}
+		g.Failure("192.0.2.1", "admin")
+	}
+
+	wait, ok := g.Check("192.0.2.1", "other")
+	if ok || wait <= time.Duration(policy.MaxDelay)*time.Second {
+		t.Errorf("Check = %s, %v; want the IP locked out", wait, ok)
+	}
+	advance(time.Duration(policy.Duration) * time.Second)
+	if _, ok := g.Check("192.0.2.1", "other"); !ok {
+		t.Error("IP still locked out after the lockout duration")
+	}
+}
+
+func TestFailureOnlyDelaysUsername(t *testing.T) {
+	g, advance := newTestGuard()
+	policy := config.DefaultConfig().Server.Admin.Lockout
+	maxDelay := time.Duration(policy.MaxDelay) * time.Second
+
+	// Failures from many clients never lock the username out
+	for i := 0; i < 3*policy.MaxFailures; i++ {
+		ip := fmt.Sprintf("192.0.2.%d", i+1)
+		wait, ok := g.Check(ip, "admin")
+		if !ok {
+			if wait > maxDelay {
+				t.Fatalf("username waits %s after %d failures, want at most %s", wait, i, maxDelay)
+			}
+			advance(wait)
+			if _, ok = g.Check(ip, "admin"); !ok {
+				t.Fatalf("attempt %d refused after waiting %s", i+1, wait)
+			}
+		}
+		g.Failure(ip, "admin")
+	}
+
+	status := g.Status().(map[string]interface{})
+	if users := status["delayed_usernames"].([]string); len(users) != 1 || users[0] != "admin" {
+		t.Errorf("delayed_usernames = %v, want [admin]", users)
+	}
+	advance(maxDelay)
+	if _, ok := g.Check("198.51.100.1", "admin"); !ok {
+		t.Error("username refused after the maximum delay")
+	}
+}
+
+func TestSuccessClearsFailures(t *testing.T) {
+	g, _ := newTestGuard()
+	g.Check("192.0.2.1", "admin")
+	g.Failure("192.0.2.1", "admin")
+	g.Success("192.0.2.1", "admin")
+	if wait, ok := g.Check("192.0.2.1", "admin"); !ok {
+		t.Errorf("attempt after success waits %s", wait)
+	}
+}
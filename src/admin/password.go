@@ -0,0 +1,233 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// Argon2 hash settings
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Argon2Params is the cost of an Argon2id hash. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params is the cost used when none is configured
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+
+// Argon2ParamsFromConfig converts server.admin.argon2, falling back to the
+// defaults for values out of range
+func Argon2ParamsFromConfig(c config.Argon2Config) Argon2Params {
+	p := DefaultArgon2Params
+	if c.Parallelism >= 1 && c.Parallelism <= 255 {
+		p.Parallelism = uint8(c.Parallelism)
+	}
+	if c.Memory >= 8*int(p.Parallelism) {
+		p.Memory = uint32(c.Memory)
+	}
+	if c.Iterations >= 1 {
+		p.Iterations = uint32(c.Iterations)
+	}
+	return p
+}
+
+// String formats the parameters as in an encoded hash
+func (p Argon2Params) String() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+}
+
+// HashPassword creates an Argon2id hash of the password with the default
+// parameters
+func HashPassword(password string) (string, error) {
+	return HashPasswordWith(password, DefaultArgon2Params)
+}
+
+// HashPasswordWith creates an Argon2id hash of the password with params
+func HashPasswordWith(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, argon2KeyLen)
+
+	// Format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
+	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
+
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params, b64Salt, b64Hash), nil
+}
+
+// argon2Hash is a decoded "$argon2id$v=19$m=...,t=...,p=...$salt$hash"
+type argon2Hash struct {
+	variant string
+	version int
+	params  Argon2Params
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2Hash decodes an encoded Argon2 hash in the PHC string format
+func parseArgon2Hash(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return nil, fmt.Errorf("malformed argon2 hash")
+	}
+
+	h := &argon2Hash{variant: parts[1]}
+	if h.variant != "argon2id" && h.variant != "argon2i" {
+		return nil, fmt.Errorf("unsupported hash variant %q", h.variant)
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &h.version); err != nil {
+		return nil, fmt.Errorf("malformed argon2 version %q", parts[2])
+	}
+	if h.version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", h.version)
+	}
+
+	var m, t, p uint64
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &m, &t, &p); err != nil {
+		return nil, fmt.Errorf("malformed argon2 parameters %q", parts[3])
+	}
+	if t < 1 || p < 1 || p > 255 || m < 8*p || m > 1<<32-1 || t > 1<<32-1 {
+		return nil, fmt.Errorf("argon2 parameters %q out of range", parts[3])
+	}
+	h.params = Argon2Params{Memory: uint32(m), Iterations: uint32(t), Parallelism: uint8(p)}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2 salt: %w", err)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("malformed argon2 hash: %w", err)
+	}
+	if len(h.key) == 0 {
+		return nil, fmt.Errorf("malformed argon2 hash: empty key")
+	}
+	return h, nil
+}
+
+// verifyArgon2Hash verifies a password against an Argon2 hash, using the
+// variant, parameters and key length recorded in the hash
+func verifyArgon2Hash(password, encodedHash string) bool {
+	h, err := parseArgon2Hash(encodedHash)
+	if err != nil {
+		logging.Errorf("admin: cannot verify stored password: %v", err)
+		return false
+	}
+
+	p, keyLen := h.params, uint32(len(h.key))
+	var key []byte
+	if h.variant == "argon2i" {
+		key = argon2.Key([]byte(password), h.salt, p.Iterations, p.Memory, p.Parallelism, keyLen)
+	} else {
+		key = argon2.IDKey([]byte(password), h.salt, p.Iterations, p.Memory, p.Parallelism, keyLen)
+	}
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// needsRehash reports whether a stored password is plain text or a hash
+// made with other settings than params
+func needsRehash(stored string, params Argon2Params) bool {
+	if !strings.HasPrefix(stored, "$argon2") {
+		return true
+	}
+	h, err := parseArgon2Hash(stored)
+	if err != nil {
+		return false
+	}
+	return h.variant != "argon2id" || h.params != params ||
+		len(h.salt) < argon2SaltLen || len(h.key) != argon2KeyLen
+}
+
+// SetPasswordHashing sets the cost of new password hashes and the function
+// that stores an upgraded hash. Without store the password is left as is.
+func (am *AuthManager) SetPasswordHashing(params Argon2Params, store func(hash string) error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.argon2 = params
+	am.storeHash = store
+}
+
+// passwordUpgrade is a new hash of the admin password waiting to replace
+// the stored one
+type passwordUpgrade struct {
+	stored string
+	hash   string
+	params Argon2Params
+}
+
+// preparePasswordUpgrade hashes password, which was just verified, when the
+// stored admin password is plain text or uses outdated settings. Nothing
+// is stored until applyPasswordUpgrade, which callers run once the login
+// is complete.
+func (am *AuthManager) preparePasswordUpgrade(password string) *passwordUpgrade {
+	am.mu.RLock()
+	stored, params, store := am.adminPassHash, am.argon2, am.storeHash
+	am.mu.RUnlock()
+	if store == nil || !needsRehash(stored, params) {
+		return nil
+	}
+
+	hash, err := HashPasswordWith(password, params)
+	if err != nil {
+		am.rehashFailedOnce(stored, params, err)
+		return nil
+	}
+	return &passwordUpgrade{stored: stored, hash: hash, params: params}
+}
+
+// applyPasswordUpgrade stores a prepared hash and reports whether the
+// stored password was replaced. A nil upgrade does nothing.
+func (am *AuthManager) applyPasswordUpgrade(u *passwordUpgrade) bool {
+	if u == nil {
+		return false
+	}
+	am.mu.RLock()
+	stored, store := am.adminPassHash, am.storeHash
+	am.mu.RUnlock()
+	// The password or the store changed since the login started
+	if store == nil || stored != u.stored {
+		return false
+	}
+
+	if err := store(u.hash); err != nil {
+		am.rehashFailedOnce(u.stored, u.params, err)
+		return false
+	}
+
+	am.mu.Lock()
+	if am.adminPassHash == u.stored {
+		am.adminPassHash = u.hash
+	}
+	am.mu.Unlock()
+	log.Printf("admin: upgraded the stored admin password to an Argon2id hash with %s", u.params)
+	return true
+}
+
+// rehashFailedOnce warns that the stored password could not be upgraded,
+// once per stored password rather than at every login
+func (am *AuthManager) rehashFailedOnce(stored string, params Argon2Params, err error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	if am.rehashFailed == stored {
+		return
+	}
+	am.rehashFailed = stored
+	logging.Warnf("admin password is not stored as an Argon2id hash with %s and could not be upgraded: %v", params, err)
+}
@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scopes granted to API tokens through their Permissions. ScopeAll grants
+// every scope.
+const (
+	ScopeAll         = "*"
+	ScopeStatusRead  = "status:read"
+	ScopeConfigRead  = "config:read"
+	ScopeConfigWrite = "config:write"
+	ScopeReload      = "reload"
+	ScopeDataWrite   = "data:write"
+	ScopeTokensAdmin = "tokens:admin"
+	ScopeAuditRead   = "audit:read"
+)
+
+// Scopes lists every scope a token can be given
+var Scopes = []string{
+	ScopeStatusRead,
+	ScopeConfigRead,
+	ScopeConfigWrite,
+	ScopeReload,
+	ScopeDataWrite,
+	ScopeTokensAdmin,
+	ScopeAuditRead,
+}
+
+// readOnlyScope reports whether scope only grants reading
+func readOnlyScope(scope string) bool {
+	return strings.HasSuffix(scope, ":read")
+}
+
+// ValidateScopes checks that every entry names a known scope
+func ValidateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if s == ScopeAll {
+			continue
+		}
+		known := false
+		for _, k := range Scopes {
+			if s == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q (expected %s or %s)", s, strings.Join(Scopes, ", "), ScopeAll)
+		}
+	}
+	return nil
+}
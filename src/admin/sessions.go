@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sessionsFile holds admin sessions in the data directory
+const sessionsFile = "sessions.json"
+
+// SessionStore keeps admin sessions by ID. IDs are SHA-256 hashes of the
+// session cookie, so a leaked store cannot be used to log in.
+type SessionStore interface {
+	Get(id string) (*Session, bool)
+	Put(s *Session) error
+	Delete(id string) error
+	List() ([]*Session, error)
+	DeleteExpired(now time.Time) error
+}
+
+// MemorySessionStore keeps sessions in memory; they end with the process
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemorySessionStore creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*Session)}
+}
+
+// Get returns a copy of the session with id
+func (m *MemorySessionStore) Get(id string) (*Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	c := *s
+	return &c, true
+}
+
+// Put adds or replaces a session
+func (m *MemorySessionStore) Put(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *s
+	m.sessions[s.ID] = &c
+	return nil
+}
+
+// Delete removes a session
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// List returns every session, newest first
+func (m *MemorySessionStore) List() ([]*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sortedSessions(m.sessions), nil
+}
+
+// DeleteExpired removes sessions that expired before now
+func (m *MemorySessionStore) DeleteExpired(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// FileSessionStore keeps sessions in memory and writes every change to a
+// JSON file in the data directory, so admins stay logged in across
+// restarts
+type FileSessionStore struct {
+	MemorySessionStore
+	path string
+	// writeMu orders file writes
+	writeMu sync.Mutex
+}
+
+// NewFileSessionStore opens the session file in dataDir; expired sessions
+// are dropped on load
+func NewFileSessionStore(dataDir string) (*FileSessionStore, error) {
+	f := &FileSessionStore{
+		MemorySessionStore: MemorySessionStore{sessions: make(map[string]*Session)},
+		path:               filepath.Join(dataDir, sessionsFile),
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read session store: %w", err)
+	}
+	if len(data) > 0 {
+		var list []*Session
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse session store %s: %w", f.path, err)
+		}
+		now := time.Now()
+		for _, s := range list {
+			if now.Before(s.ExpiresAt) {
+				f.sessions[s.ID] = s
+			}
+		}
+	}
+	return f, nil
+}
+
+// Put adds or replaces a session and saves the store
+func (f *FileSessionStore) Put(s *Session) error {
+	f.MemorySessionStore.Put(s)
+	return f.save()
+}
+
+// Delete removes a session and saves the store
+func (f *FileSessionStore) Delete(id string) error {
+	f.MemorySessionStore.Delete(id)
+	return f.save()
+}
+
+// DeleteExpired removes expired sessions and saves the store
+func (f *FileSessionStore) DeleteExpired(now time.Time) error {
+	f.MemorySessionStore.DeleteExpired(now)
+	return f.save()
+}
+
+// save writes the current sessions to the file
+func (f *FileSessionStore) save() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	list, _ := f.List()
+	if err := writeJSONFile(f.path, list); err != nil {
+		return fmt.Errorf("failed to write session store: %w", err)
+	}
+	return nil
+}
+
+// sortedSessions copies sessions newest first
+func sortedSessions(m map[string]*Session) []*Session {
+	list := make([]*Session, 0, len(m))
+	for _, s := range m {
+		c := *s
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
@@ -0,0 +1,362 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/apimgr/gitmessages/src/audit"
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/logging"
+	"github.com/apimgr/gitmessages/src/middleware"
+)
+
+// settingField is one setting on the settings page. Kind is text, number,
+// bool, select or lines (a list edited one entry per line).
+type settingField struct {
+	Key     string
+	Label   string
+	Kind    string
+	Options []string
+	Help    string
+}
+
+// settingSection groups fields on the settings page
+type settingSection struct {
+	Title  string
+	Fields []settingField
+}
+
+// settingSections are the settings that can be edited from the admin
+// interface and PATCH /api/v1/admin/config
+var settingSections = []settingSection{
+	{"Web UI", []settingField{
+		{Key: "web-ui.theme", Label: "Theme", Kind: "select", Options: []string{"dark", "light", "auto"}},
+		{Key: "web-ui.logo", Label: "Logo", Kind: "text", Help: "Path on this server or http(s) URL"},
+		{Key: "web-ui.favicon", Label: "Favicon", Kind: "text", Help: "Path on this server or http(s) URL"},
+		{Key: "web-ui.notifications.enabled", Label: "Show announcements", Kind: "bool"},
+		{Key: "web-ui.notifications.announcements", Label: "Announcements", Kind: "lines", Help: "One per line"},
+	}},
+	{"Robots", []settingField{
+		{Key: "web-robots.allow", Label: "Allow", Kind: "lines", Help: "One path per line"},
+		{Key: "web-robots.deny", Label: "Disallow", Kind: "lines", Help: "One path per line"},
+	}},
+	{"Security", []settingField{
+		{Key: "web-security.admin", Label: "Security contact", Kind: "text", Help: "Email address published in security.txt"},
+		{Key: "web-security.cors", Label: "CORS origins", Kind: "text", Help: `"*", empty, or comma-separated origins`},
+	}},
+	{"Metrics", []settingField{
+		{Key: "server.metrics.enabled", Label: "Enabled", Kind: "bool"},
+		{Key: "server.metrics.endpoint", Label: "Endpoint", Kind: "text"},
+		{Key: "server.metrics.include_system", Label: "Include system metrics", Kind: "bool"},
+		{Key: "server.metrics.include_app", Label: "Include application metrics", Kind: "bool"},
+	}},
+	{"Logging", []settingField{
+		{Key: "server.logging.level", Label: "Level", Kind: "select", Options: []string{"debug", "info", "warn", "error"}},
+		{Key: "server.logging.access_format", Label: "Access log format", Kind: "select", Options: []string{"apache", "json"}},
+	}},
+	{"Session", []settingField{
+		{Key: "server.session.timeout", Label: "Timeout (seconds)", Kind: "number"},
+	}},
+}
+
+// settingFieldByKey returns the editable field for key
+func settingFieldByKey(key string) (settingField, bool) {
+	for _, s := range settingSections {
+		for _, f := range s.Fields {
+			if f.Key == key {
+				return f, true
+			}
+		}
+	}
+	return settingField{}, false
+}
+
+// settingView is a field as rendered, with its value and why it cannot be
+// edited, if it cannot
+type settingView struct {
+	settingField
+	Value    string
+	Checked  bool
+	LockedBy string
+	Restart  bool
+}
+
+// settingsPage is the data of the settings template
+type settingsPage struct {
+	CSRF     string
+	Sections []struct {
+		Title  string
+		Fields []settingView
+	}
+	Message  string
+	Problems []string
+	Changes  []config.Change
+	Preview  string
+	Restart  []string
+}
+
+// SetRestartCheck sets how the settings editor tells which keys only take
+// effect after a restart
+func (h *Handler) SetRestartCheck(fn func(key string) bool) {
+	h.restartMu.Lock()
+	defer h.restartMu.Unlock()
+	h.needsRestart = fn
+}
+
+// restartKeys returns the changed keys that need a restart
+func (h *Handler) restartKeys(changes []config.Change) []string {
+	h.restartMu.RLock()
+	fn := h.needsRestart
+	h.restartMu.RUnlock()
+
+	keys := []string{}
+	for _, c := range changes {
+		if fn != nil && fn(c.Key) {
+			keys = append(keys, c.Key)
+		}
+	}
+	return keys
+}
+
+// lockedSettings returns the editable keys that are set outside the main
+// config file, with their source
+func lockedSettings() map[string]string {
+	locked := make(map[string]string)
+	for _, s := range settingSections {
+		for _, f := range s.Fields {
+			if src, ok := config.Locked(f.Key); ok {
+				locked[f.Key] = src
+			}
+		}
+	}
+	return locked
+}
+
+// settingsEditFromForm reads the settings form. Fields set outside the
+// main config file are left out.
+func settingsEditFromForm(form url.Values, locked map[string]string) config.Edit {
+	edit := config.Edit{}
+	for _, s := range settingSections {
+		for _, f := range s.Fields {
+			if _, ok := locked[f.Key]; ok {
+				continue
+			}
+			switch f.Kind {
+			case "bool":
+				edit[f.Key] = fmt.Sprint(form.Get(f.Key) != "")
+			case "lines":
+				lines := []string{}
+				for _, line := range strings.Split(form.Get(f.Key), "\n") {
+					if line = strings.TrimSpace(line); line != "" {
+						lines = append(lines, line)
+					}
+				}
+				data, _ := json.Marshal(lines)
+				edit[f.Key] = string(data)
+			default:
+				edit[f.Key] = strings.TrimSpace(form.Get(f.Key))
+			}
+		}
+	}
+	return edit
+}
+
+// editHash identifies a previewed edit so a save applies exactly what was
+// previewed
+func editHash(edit config.Edit) string {
+	keys := make([]string, 0, len(edit))
+	for key := range edit {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, edit[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validationProblems lists the problems of a failed edit
+func validationProblems(err error) []string {
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		return []string{err.Error()}
+	}
+	problems := make([]string, len(verr.Problems))
+	for i, p := range verr.Problems {
+		problems[i] = p.String()
+	}
+	return problems
+}
+
+// handleAdminSettings shows the settings form (GET), previews the changes
+// of a submitted form, and saves them once previewed
+func (h *Handler) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
+	page := &settingsPage{CSRF: h.auth.csrfToken(w, r)}
+	locked := lockedSettings()
+	if r.Method != http.MethodPost {
+		h.renderSettingsPage(w, page, nil, locked)
+		return
+	}
+
+	r.ParseForm()
+	edit := settingsEditFromForm(r.PostForm, locked)
+	hash := editHash(edit)
+
+	if r.PostFormValue("action") == "save" {
+		if r.PostFormValue("preview") == hash {
+			h.saveSettings(w, r, page, edit, locked)
+			return
+		}
+		page.Message = "The settings changed since the preview; review the changes and save again."
+	}
+
+	changes, err := config.PreviewEdit(edit)
+	switch {
+	case err != nil:
+		page.Problems = validationProblems(err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case len(changes) == 0:
+		page.Message = "No changes."
+	default:
+		page.Changes = changes
+		page.Restart = h.restartKeys(changes)
+		page.Preview = hash
+	}
+	h.renderSettingsPage(w, page, r.PostForm, locked)
+}
+
+// saveSettings applies a previewed edit and records it in the audit log
+func (h *Handler) saveSettings(w http.ResponseWriter, r *http.Request, page *settingsPage, edit config.Edit, locked map[string]string) {
+	changes, err := config.ApplyEdit(edit)
+	e := AuditEvent(r, audit.ActionConfigChange, err == nil)
+	e.Detail = "settings page"
+	e.Changes = changes
+	if err != nil {
+		e.Detail += ": " + err.Error()
+	}
+	if err != nil || len(changes) > 0 {
+		h.audit().Record(e)
+	}
+	if err != nil {
+		logging.Warnf("Admin: saving settings failed [request_id=%s]: %v", middleware.GetRequestID(r.Context()), err)
+		page.Problems = validationProblems(err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		h.renderSettingsPage(w, page, r.PostForm, locked)
+		return
+	}
+
+	log.Printf("Admin: %s saved %d setting(s) [request_id=%s]", Actor(r), len(changes), middleware.GetRequestID(r.Context()))
+	page.Message = fmt.Sprintf("Saved and applied %d change(s).", len(changes))
+	page.Changes = changes
+	page.Restart = h.restartKeys(changes)
+	h.renderSettingsPage(w, page, nil, locked)
+}
+
+// renderSettingsPage fills in the fields from form, or from the running
+// configuration when form is nil, and renders the page
+func (h *Handler) renderSettingsPage(w http.ResponseWriter, page *settingsPage, form url.Values, locked map[string]string) {
+	cfg := config.Get()
+	for _, s := range settingSections {
+		section := struct {
+			Title  string
+			Fields []settingView
+		}{Title: s.Title}
+		for _, f := range s.Fields {
+			v := settingView{settingField: f, LockedBy: locked[f.Key], Restart: len(h.restartKeys([]config.Change{{Key: f.Key}})) > 0}
+			if form != nil && v.LockedBy == "" {
+				v.Value = form.Get(f.Key)
+				v.Checked = v.Value != ""
+			} else {
+				value, _ := config.GetKey(cfg, f.Key)
+				switch x := value.(type) {
+				case bool:
+					v.Checked = x
+				case []string:
+					v.Value = strings.Join(x, "\n")
+				default:
+					v.Value = fmt.Sprint(x)
+				}
+			}
+			section.Fields = append(section.Fields, v)
+		}
+		page.Sections = append(page.Sections, section)
+	}
+
+	tmpl := template.Must(template.New("settings").Parse(settingsTemplate))
+	tmpl.Execute(w, page)
+}
+
+// handleAPIPatchConfig changes editable settings from a JSON object of
+// keys and values. With ?dry_run=true the changes are only returned.
+func (h *Handler) handleAPIPatchConfig(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	edit := config.Edit{}
+	for key, value := range body {
+		if _, ok := settingFieldByKey(key); !ok {
+			writeAPIError(w, r, http.StatusBadRequest, fmt.Sprintf("%s cannot be changed through the API", key))
+			return
+		}
+		if s, ok := value.(string); ok {
+			edit[key] = s
+			continue
+		}
+		data, _ := json.Marshal(value)
+		edit[key] = string(data)
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	var changes []config.Change
+	var err error
+	if dryRun {
+		changes, err = config.PreviewEdit(edit)
+	} else {
+		changes, err = config.ApplyEdit(edit)
+		e := AuditEvent(r, audit.ActionConfigChange, err == nil)
+		e.Detail = "API"
+		e.Changes = changes
+		if err != nil {
+			e.Detail += ": " + err.Error()
+		}
+		h.audit().Record(e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "failed",
+			"error":      "invalid configuration",
+			"problems":   validationProblems(err),
+			"request_id": middleware.GetRequestID(r.Context()),
+		})
+		return
+	}
+
+	if changes == nil {
+		changes = []config.Change{}
+	}
+	status := "saved"
+	if dryRun {
+		status = "preview"
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":           status,
+		"changes":          changes,
+		"restart_required": h.restartKeys(changes),
+	})
+}
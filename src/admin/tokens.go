@@ -0,0 +1,299 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenPrefix starts every generated API token so leaked tokens are easy to
+// recognise
+const TokenPrefix = "gm_"
+
+// tokensFile holds the token store in the data directory
+const tokensFile = "tokens.json"
+
+// ErrTokenNotFound is returned for an unknown token ID
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore keeps API tokens in a JSON file in the data directory. Only a
+// SHA-256 hash of each token is stored; the token itself is shown once when
+// it is created or rotated. Changes made by another process, such as the
+// CLI, are picked up on the next lookup.
+type TokenStore struct {
+	path    string
+	mu      sync.Mutex
+	tokens  map[string]*APIToken
+	byHash  map[string]*APIToken
+	modTime time.Time
+	dirty   bool
+}
+
+// NewTokenStore opens the token store in dataDir
+func NewTokenStore(dataDir string) *TokenStore {
+	s := &TokenStore{
+		path:   filepath.Join(dataDir, tokensFile),
+		tokens: make(map[string]*APIToken),
+		byHash: make(map[string]*APIToken),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	return s
+}
+
+// Create adds a token and returns it with its secret value. A ttl of zero
+// never expires.
+func (s *TokenStore) Create(name string, permissions []string, ttl time.Duration) (*APIToken, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if len(permissions) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required (%s for every scope)", ScopeAll)
+	}
+	if err := ValidateScopes(permissions); err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, "", err
+	}
+
+	secret := TokenPrefix + generateSecureToken(40)
+	t := &APIToken{
+		ID:          newTokenID(),
+		Name:        name,
+		Hash:        hashToken(secret),
+		Permissions: permissions,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if ttl > 0 {
+		t.ExpiresAt = t.CreatedAt.Add(ttl)
+	}
+	s.tokens[t.ID] = t
+	s.byHash[t.Hash] = t
+	if err := s.save(); err != nil {
+		return nil, "", err
+	}
+	return t.public(), secret, nil
+}
+
+// List returns every token sorted by creation time
+func (s *TokenStore) List() ([]*APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	list := make([]*APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t.public())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Rotate replaces the secret of a token, keeping its name, permissions and
+// expiry, and returns the new secret
+func (s *TokenStore) Rotate(id string) (*APIToken, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, "", err
+	}
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, "", ErrTokenNotFound
+	}
+	secret := TokenPrefix + generateSecureToken(40)
+	delete(s.byHash, t.Hash)
+	t.Hash = hashToken(secret)
+	t.RotatedAt = time.Now().UTC()
+	s.byHash[t.Hash] = t
+	if err := s.save(); err != nil {
+		return nil, "", err
+	}
+	return t.public(), secret, nil
+}
+
+// Revoke deletes a token
+func (s *TokenStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, id)
+	delete(s.byHash, t.Hash)
+	return s.save()
+}
+
+// Lookup returns the unexpired token matching secret and records its use
+func (s *TokenStore) Lookup(secret string) (*APIToken, bool) {
+	if !strings.HasPrefix(secret, TokenPrefix) {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+
+	t, ok := s.byHash[hashToken(secret)]
+	if !ok || t.Expired() {
+		return nil, false
+	}
+	t.LastUsed = time.Now().UTC()
+	s.dirty = true
+	return t.public(), true
+}
+
+// Flush writes last-used times recorded since the last save
+func (s *TokenStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// load re-reads the file when it changed since it was last read. Last-used
+// times not yet written are kept. Callers hold s.mu.
+func (s *TokenStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+	var list []*APIToken
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse token store %s: %w", s.path, err)
+	}
+
+	tokens := make(map[string]*APIToken, len(list))
+	byHash := make(map[string]*APIToken, len(list))
+	for _, t := range list {
+		if old, ok := s.tokens[t.ID]; ok && old.LastUsed.After(t.LastUsed) {
+			t.LastUsed = old.LastUsed
+		}
+		tokens[t.ID] = t
+		byHash[t.Hash] = t
+	}
+	s.tokens, s.byHash, s.modTime = tokens, byHash, info.ModTime()
+	return nil
+}
+
+// save writes the store atomically with owner-only permissions. Callers
+// hold s.mu.
+func (s *TokenStore) save() error {
+	list := make([]*APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	if err := writeJSONFile(s.path, list); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	s.dirty = false
+	return nil
+}
+
+// writeJSONFile writes v as indented JSON to path atomically, readable only
+// by the owner
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ParseTTL parses a token lifetime such as "720h" or "90d"; empty or "0"
+// never expires
+func ParseTTL(s string) (time.Duration, error) {
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// hashToken returns the hex SHA-256 of a token secret. Tokens are random,
+// so a fast hash is enough.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTokenID returns a short random identifier for a token
+func newTokenID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
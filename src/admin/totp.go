@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by every authenticator app)
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew accepts codes from this many periods before and after now
+	totpSkew = 1
+)
+
+// totpEncoding is unpadded base32, as used in otpauth URIs
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret, base32 encoded
+func NewTOTPSecret() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return totpEncoding.EncodeToString(b)
+}
+
+// totpCode computes the code for a secret and time step (RFC 4226 HOTP)
+func totpCode(key []byte, step uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], step)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// TOTPCode returns the current code for secret at t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, uint64(t.Unix()/totpPeriod)), nil
+}
+
+// ValidateTOTP reports whether code is valid for secret at t
+func ValidateTOTP(secret, code string, t time.Time) bool {
+	_, ok := verifyTOTP(secret, code, t, 0)
+	return ok
+}
+
+// verifyTOTP checks code against secret around t and returns the matching
+// time step. Steps up to and including after are rejected so a code
+// cannot be replayed.
+func verifyTOTP(secret, code string, t time.Time, after uint64) (uint64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := t.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := uint64(now + int64(i))
+		if step <= after {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// decodeTOTPSecret decodes a base32 secret, ignoring case and spaces
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := totpEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return key, nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps enrol from
+func TOTPURI(secret, account, issuer string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// NewRecoveryCodes returns n random one-time recovery codes such as
+// "k3x9p-q2m7d"
+func NewRecoveryCodes(n int) []string {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	// Random bytes at or above limit are drawn again, so that every
+	// character is equally likely
+	const limit = 256 - 256%len(alphabet)
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 0, 10)
+		var r [1]byte
+		for len(b) < cap(b) {
+			rand.Read(r[:])
+			if int(r[0]) < limit {
+				b = append(b, alphabet[int(r[0])%len(alphabet)])
+			}
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+	return codes
+}
+
+// hashRecoveryCode returns the stored form of a recovery code
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// TerminalQR renders text as a QR code using Unicode half blocks, two
+// modules per character row, with a quiet zone for scanning
+func TerminalQR(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	const quiet = 2
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := code.Black(x, y), code.Black(x, y+1)
+			// Light modules are drawn so the code works on dark terminals
+			switch {
+			case top && bottom:
+				b.WriteString(" ")
+			case top:
+				b.WriteString("▄")
+			case bottom:
+				b.WriteString("▀")
+			default:
+				b.WriteString("█")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,269 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// twoFactorFile holds the admin TOTP secret and recovery codes in the data
+// directory
+const twoFactorFile = "admin-2fa.json"
+
+// TOTPIssuer names the account in authenticator apps
+const TOTPIssuer = "GitMessages"
+
+// twoFactorState is the stored second factor. Recovery codes are SHA-256
+// hashes and are removed once used.
+type twoFactorState struct {
+	Secret        string    `json:"secret"`
+	RecoveryCodes []string  `json:"recovery_codes"`
+	EnabledAt     time.Time `json:"enabled_at"`
+	LastStep      uint64    `json:"last_step"`
+}
+
+// TwoFactor manages the optional TOTP second factor of the admin account.
+// It is enabled by the CLI; a running server picks the change up on the
+// next login.
+type TwoFactor struct {
+	path    string
+	mu      sync.Mutex
+	state   *twoFactorState
+	modTime time.Time
+	now     func() time.Time
+}
+
+// NewTwoFactor opens the second factor settings in dataDir
+func NewTwoFactor(dataDir string) *TwoFactor {
+	return &TwoFactor{path: filepath.Join(dataDir, twoFactorFile), now: time.Now}
+}
+
+// SetClock replaces the time source used to check codes
+func (t *TwoFactor) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.now = now
+}
+
+// Enabled reports whether logins need a second factor
+func (t *TwoFactor) Enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(); err != nil {
+		// Fail closed: a damaged file must not turn 2FA off
+		return true
+	}
+	return t.state != nil
+}
+
+// Enable stores secret and the hashes of recovery codes, replacing any
+// previous second factor
+func (t *TwoFactor) Enable(secret string, recovery []string) error {
+	if _, err := decodeTOTPSecret(secret); err != nil {
+		return err
+	}
+	hashes := make([]string, len(recovery))
+	for i, code := range recovery {
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.save(&twoFactorState{Secret: secret, RecoveryCodes: hashes, EnabledAt: t.now().UTC()})
+}
+
+// Disable removes the second factor
+func (t *TwoFactor) Disable() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	t.state, t.modTime = nil, time.Time{}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes with n new ones
+func (t *TwoFactor) RegenerateRecoveryCodes(n int) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	if t.state == nil {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	codes := NewRecoveryCodes(n)
+	state := *t.state
+	state.RecoveryCodes = make([]string, len(codes))
+	for i, code := range codes {
+		state.RecoveryCodes[i] = hashRecoveryCode(code)
+	}
+	return codes, t.save(&state)
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes
+func (t *TwoFactor) RecoveryCodesLeft() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.load() != nil || t.state == nil {
+		return 0
+	}
+	return len(t.state.RecoveryCodes)
+}
+
+// Verify checks a TOTP code or a recovery code. A TOTP code is accepted
+// once; a recovery code is used up.
+func (t *TwoFactor) Verify(code string) (recovery bool, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.load() != nil || t.state == nil {
+		return false, false
+	}
+
+	state := *t.state
+	if step, valid := verifyTOTP(state.Secret, code, t.now(), state.LastStep); valid {
+		state.LastStep = step
+		return false, t.save(&state) == nil
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, h := range state.RecoveryCodes {
+		if h == hash {
+			state.RecoveryCodes = append(append([]string(nil), state.RecoveryCodes[:i]...), state.RecoveryCodes[i+1:]...)
+			return true, t.save(&state) == nil
+		}
+	}
+	return false, false
+}
+
+// load re-reads the file when it changed. Callers hold t.mu.
+func (t *TwoFactor) load() error {
+	info, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		t.state, t.modTime = nil, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read two-factor settings: %w", err)
+	}
+	if t.state != nil && info.ModTime().Equal(t.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to read two-factor settings: %w", err)
+	}
+	var state twoFactorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse two-factor settings %s: %w", t.path, err)
+	}
+	if _, err := decodeTOTPSecret(state.Secret); err != nil {
+		return fmt.Errorf("failed to parse two-factor settings %s: %w", t.path, err)
+	}
+	t.state, t.modTime = &state, info.ModTime()
+	return nil
+}
+
+// save writes state. Callers hold t.mu.
+func (t *TwoFactor) save(state *twoFactorState) error {
+	if err := writeJSONFile(t.path, state); err != nil {
+		return fmt.Errorf("failed to write two-factor settings: %w", err)
+	}
+	t.state = state
+	if info, err := os.Stat(t.path); err == nil {
+		t.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Second login step settings
+const (
+	pendingCookieName  = "admin_2fa"
+	pendingLoginTTL    = 5 * time.Minute
+	maxPendingAttempts = 5
+)
+
+// pendingLogin is a login that passed the password check and waits for the
+// second factor
+type pendingLogin struct {
+	Username  string
+	IP        string
+	ExpiresAt time.Time
+	Attempts  int
+	Upgrade   *passwordUpgrade
+}
+
+// startPendingLogin records a password-verified login, with the password
+// upgrade to store once it completes, and sets the cookie that identifies
+// it in the second step
+func (am *AuthManager) startPendingLogin(w http.ResponseWriter, username, ip string, upgrade *passwordUpgrade) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	id := generateSecureToken(32)
+	am.pending[id] = &pendingLogin{Username: username, IP: ip, ExpiresAt: time.Now().Add(pendingLoginTTL), Upgrade: upgrade}
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingCookieName,
+		Value:    id,
+		Path:     "/admin/login",
+		HttpOnly: true,
+		Secure:   am.sslEnabled,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(pendingLoginTTL.Seconds()),
+	})
+}
+
+// pendingLoginFromRequest returns the unexpired pending login of the
+// request, which must come from the same IP
+func (am *AuthManager) pendingLoginFromRequest(r *http.Request) (string, pendingLogin, bool) {
+	c, err := r.Cookie(pendingCookieName)
+	if err != nil {
+		return "", pendingLogin{}, false
+	}
+
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	p, ok := am.pending[c.Value]
+	if !ok || time.Now().After(p.ExpiresAt) || p.IP != GetClientIP(r) {
+		return "", pendingLogin{}, false
+	}
+	return c.Value, *p, true
+}
+
+// failPendingLogin counts a wrong code and drops the pending login after
+// too many; it reports whether the login may still be completed
+func (am *AuthManager) failPendingLogin(id string) bool {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	p, ok := am.pending[id]
+	if !ok {
+		return false
+	}
+	p.Attempts++
+	if p.Attempts >= maxPendingAttempts {
+		delete(am.pending, id)
+		return false
+	}
+	return true
+}
+
+// endPendingLogin removes a pending login and its cookie
+func (am *AuthManager) endPendingLogin(w http.ResponseWriter, id string) {
+	am.mu.Lock()
+	delete(am.pending, id)
+	am.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingCookieName,
+		Value:    "",
+		Path:     "/admin/login",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/config"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := decodeTOTPSecret(rfcSecret)
+	if err != nil {
+		t.Fatalf("decodeTOTPSecret: %v", err)
+	}
+	// RFC 6238 appendix B lists 8-digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range tests {
+		if got := totpCode(key, uint64(tc.unix/totpPeriod)); got != tc.want {
+			t.Errorf("code at %d = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := NewRecoveryCodes(200)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || strings.Trim(code[:5]+code[6:], alphabet) != "" {
+			t.Fatalf("code %q is not five and five characters of the alphabet", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+// fakeClock is a settable time source for TwoFactor.SetClock
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// newTestTwoFactor enables rfcSecret with recovery codes, checking codes
+// at clock
+func newTestTwoFactor(t *testing.T, clock *fakeClock, recovery ...string) *TwoFactor {
+	t.Helper()
+	tf := NewTwoFactor(t.TempDir())
+	tf.SetClock(clock.Now)
+	if err := tf.Enable(rfcSecret, recovery); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	return tf
+}
+
+// codeAt returns the code of rfcSecret at t
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := TOTPCode(rfcSecret, at)
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	return code
+}
+
+func TestVerifySkewWindow(t *testing.T) {
+	// Start of a time step, so one second earlier is the previous step
+	start := time.Unix(1111111110, 0)
+	period := totpPeriod * time.Second
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		codeAt time.Time
+		want   bool
+	}{
+		{"current step", start, start, true},
+		{"end of current step", start.Add(period - time.Second), start, true},
+		{"previous step", start, start.Add(-period), true},
+		{"next step", start, start.Add(period), true},
+		{"last second of previous step", start.Add(period), start.Add(-time.Second), false},
+		{"two steps behind", start, start.Add(-2 * period), false},
+		{"two steps ahead", start, start.Add(2 * period), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tf := newTestTwoFactor(t, &fakeClock{now: tc.now})
+			recovery, ok := tf.Verify(codeAt(t, tc.codeAt))
+			if ok != tc.want || recovery {
+				t.Errorf("Verify = %v, %v; want false, %v", recovery, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1234567890, 0)}
+	tf := newTestTwoFactor(t, clock)
+	period := totpPeriod * time.Second
+
+	code := codeAt(t, clock.now)
+	if _, ok := tf.Verify(code); !ok {
+		t.Fatal("valid code rejected")
+	}
+	if _, ok := tf.Verify(code); ok {
+		t.Error("replayed code accepted")
+	}
+	// Still inside the skew window, but not after the step already used
+	if _, ok := tf.Verify(codeAt(t, clock.now.Add(-period))); ok {
+		t.Error("code of an earlier step accepted after a later one")
+	}
+
+	// The replay check survives reloading the file
+	clock.now = clock.now.Add(period)
+	reopened := NewTwoFactor(filepath.Dir(tf.path))
+	reopened.SetClock(clock.Now)
+	if _, ok := reopened.Verify(code); ok {
+		t.Error("replayed code accepted after reload")
+	}
+	if _, ok := reopened.Verify(codeAt(t, clock.now)); !ok {
+		t.Error("code of the next step rejected")
+	}
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	tf := newTestTwoFactor(t, &fakeClock{now: time.Unix(1234567890, 0)}, "k3x9p-q2m7d", "a2b3c-d4e5f")
+
+	// Case, spaces and dashes do not matter
+	if recovery, ok := tf.Verify("K3X9P Q2M7D"); !ok || !recovery {
+		t.Fatalf("Verify = %v, %v; want true, true", recovery, ok)
+	}
+	if left := tf.RecoveryCodesLeft(); left != 1 {
+		t.Errorf("RecoveryCodesLeft = %d, want 1", left)
+	}
+	if _, ok := tf.Verify("k3x9p-q2m7d"); ok {
+		t.Error("used recovery code accepted again")
+	}
+	if recovery, ok := tf.Verify("a2b3c-d4e5f"); !ok || !recovery {
+		t.Errorf("other recovery code: Verify = %v, %v; want true, true", recovery, ok)
+	}
+}
+
+// postForm posts a login form with a valid CSRF token
+func postForm(mux *http.ServeMux, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	const csrf = "0123456789012345678901234567890123456789012"
+	form.Set("csrf_token", csrf)
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: csrf})
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// passwordStep logs in with the admin password and returns the response
+// and the pending login cookie of the second step
+func passwordStep(t *testing.T, mux *http.ServeMux) (*httptest.ResponseRecorder, *http.Cookie) {
+	t.Helper()
+	rec := postForm(mux, "/admin/login", url.Values{"username": {"admin"}, "password": {"secret"}})
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == pendingCookieName && strings.Contains(rec.Body.String(), `name="code"`) {
+			return rec, c
+		}
+	}
+	t.Fatalf("password step: status %d, want the code form and a pending login cookie", rec.Code)
+	return nil, nil
+}
+
+func TestPendingLoginDroppedAfterMaxAttempts(t *testing.T) {
+	h, mux := newTestHandler(t)
+	clock := &fakeClock{now: time.Unix(1234567890, 0)}
+	h.twoFactor.SetClock(clock.Now)
+	if err := h.twoFactor.Enable(rfcSecret, nil); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	// Without login delays every code is checked
+	h.SetLockoutPolicy(config.LockoutConfig{})
+
+	post := func(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		return postForm(mux, path, form, cookies...)
+	}
+	rec, pending := passwordStep(t, mux)
+
+	// A code from outside the skew window is wrong
+	wrong := url.Values{"code": {codeAt(t, clock.now.Add(time.Hour))}}
+	for i := 1; i < maxPendingAttempts; i++ {
+		rec = post("/admin/login/2fa", wrong, pending)
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `name="code"`) {
+			t.Fatalf("wrong code %d: status %d, want 401 with the code form", i, rec.Code)
+		}
+	}
+	rec = post("/admin/login/2fa", wrong, pending)
+	if rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), `name="code"`) {
+		t.Fatalf("wrong code %d: status %d, want 401 with the login form", maxPendingAttempts, rec.Code)
+	}
+
+	// The right code no longer completes the dropped login
+	rec = post("/admin/login/2fa", url.Values{"code": {codeAt(t, clock.now)}}, pending)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin" {
+		t.Errorf("right code after drop: got %d to %q, want redirect to /admin", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestPasswordUpgradeWaitsForSecondFactor(t *testing.T) {
+	h, mux := newTestHandler(t)
+	clock := &fakeClock{now: time.Unix(1234567890, 0)}
+	h.twoFactor.SetClock(clock.Now)
+	if err := h.twoFactor.Enable(rfcSecret, nil); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	h.SetLockoutPolicy(config.LockoutConfig{})
+	// The test password is plain text, so a login upgrades it
+	var stored []string
+	h.SetPasswordHashing(config.DefaultConfig().Server.Admin.Argon2, func(hash string) error {
+		stored = append(stored, hash)
+		return nil
+	})
+
+	_, pending := passwordStep(t, mux)
+	if len(stored) != 0 {
+		t.Fatal("password rehashed before the second factor")
+	}
+	wrong := url.Values{"code": {codeAt(t, clock.now.Add(time.Hour))}}
+	if rec := postForm(mux, "/admin/login/2fa", wrong, pending); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: status %d, want 401", rec.Code)
+	}
+	if len(stored) != 0 {
+		t.Fatal("password rehashed after a wrong second factor")
+	}
+
+	rec := postForm(mux, "/admin/login/2fa", url.Values{"code": {codeAt(t, clock.now)}}, pending)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/dashboard" {
+		t.Fatalf("right code: got %d to %q, want redirect to /admin/dashboard", rec.Code, rec.Header().Get("Location"))
+	}
+	if len(stored) != 1 || !h.auth.Authenticate("admin", "secret") {
+		t.Fatalf("password stored %d times after login, want once and still valid", len(stored))
+	}
+
+	// An up to date hash is left alone
+	_, pending = passwordStep(t, mux)
+	clock.now = clock.now.Add(totpPeriod * time.Second)
+	postForm(mux, "/admin/login/2fa", url.Values{"code": {codeAt(t, clock.now)}}, pending)
+	if len(stored) != 1 {
+		t.Errorf("password stored %d times after a second login, want once", len(stored))
+	}
+}
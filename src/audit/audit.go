@@ -0,0 +1,402 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// FileName is the audit log in the logs directory
+const FileName = "audit.log"
+
+// Audited actions
+const (
+	ActionLogin          = "login"
+	ActionLoginFailed    = "login.failed"
+	ActionLogout         = "logout"
+	ActionSessionRevoked = "session.revoked"
+	ActionTokenUsed      = "token.used"
+	ActionTokenDenied    = "token.denied"
+	ActionTokenCreated   = "token.created"
+	ActionTokenRotated   = "token.rotated"
+	ActionTokenRevoked   = "token.revoked"
+	ActionConfigReload   = "config.reload"
+	ActionConfigChange   = "config.change"
+	ActionCycleReset     = "cycle.reset"
+)
+
+// Actors for events not caused by an HTTP request
+const (
+	ActorSignal  = "signal"
+	ActorWatcher = "watcher"
+)
+
+// Event is one line of the audit log
+type Event struct {
+	Time      time.Time       `json:"time"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	IP        string          `json:"ip,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Success   bool            `json:"success"`
+	Detail    string          `json:"detail,omitempty"`
+	Changes   []config.Change `json:"changes,omitempty"`
+}
+
+// Log appends events as JSON lines to a file. A nil *Log discards events,
+// so callers need not check whether auditing is set up.
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	f        *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+// Open opens or creates the audit log in logsDir for appending
+func Open(logsDir string) (*Log, error) {
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create logs directory: %w", err)
+	}
+	l := &Log{path: filepath.Join(logsDir, FileName)}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the current file. Callers hold l.mu or own l.
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// SetRotation rotates the file once it reaches maxSize bytes, keeping
+// maxFiles old files as audit.log.1 (newest) to audit.log.N. A maxSize of
+// 0 never rotates.
+func (l *Log) SetRotation(maxSize int64, maxFiles int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxSize, l.maxFiles = maxSize, maxFiles
+}
+
+// Record appends e, setting its time when unset. Write errors are logged;
+// they never fail the audited operation.
+func (l *Log) Record(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		logging.Errorf("failed to encode audit event %s: %v", e.Action, err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	n, err := l.f.Write(append(line, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		logging.Errorf("failed to write audit log: %v", err)
+	}
+	if l.maxSize > 0 && l.size >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			logging.Errorf("%v", err)
+		}
+	}
+}
+
+// rotate moves the current file to audit.log.1, shifting older files up
+// and removing those past maxFiles, and starts a new file. Callers hold
+// l.mu.
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	l.f = nil
+
+	os.Remove(l.rotated(l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(l.rotated(i), l.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			logging.Warnf("failed to rotate audit log: %v", err)
+		}
+	}
+	if l.maxFiles > 0 {
+		if err := os.Rename(l.path, l.rotated(1)); err != nil {
+			logging.Warnf("failed to rotate audit log: %v", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		logging.Warnf("failed to rotate audit log: %v", err)
+	}
+	return l.open()
+}
+
+// rotated returns the path of the nth old file
+func (l *Log) rotated(n int) string {
+	return l.path + "." + strconv.Itoa(n)
+}
+
+// Close closes the file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Query selects audit events. Empty fields match everything; Action also
+// matches by prefix when it ends in "." (e.g. "token.").
+type Query struct {
+	Action string
+	Actor  string
+	IP     string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Query limits
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// ParseQuery reads a query from URL parameters: action, actor, ip, since,
+// until (RFC 3339 or a duration such as "24h" before now) and limit
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{
+		Action: v.Get("action"),
+		Actor:  v.Get("actor"),
+		IP:     v.Get("ip"),
+		Limit:  DefaultLimit,
+	}
+	var err error
+	if q.Since, err = parseTime(v.Get("since")); err != nil {
+		return q, fmt.Errorf("invalid since: %w", err)
+	}
+	if q.Until, err = parseTime(v.Get("until")); err != nil {
+		return q, fmt.Errorf("invalid until: %w", err)
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("invalid limit %q", s)
+		}
+		q.Limit = min(n, MaxLimit)
+	}
+	return q, nil
+}
+
+// parseTime accepts RFC 3339 times and durations counted back from now
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// Matches reports whether e is selected by q
+func (q Query) Matches(e Event) bool {
+	switch {
+	case q.Action != "" && e.Action != q.Action &&
+		!(strings.HasSuffix(q.Action, ".") && strings.HasPrefix(e.Action, q.Action)):
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.IP != "" && e.IP != q.IP:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && e.Time.After(q.Until):
+		return false
+	}
+	return true
+}
+
+// Search returns the newest events matching q, newest first. Files are
+// read backwards from the end, from the current file to the oldest rotated
+// one, and reading stops once limit events matched or an event is older
+// than q.Since. Lines that cannot be parsed are skipped.
+func (l *Log) Search(q Query) ([]Event, error) {
+	events := []Event{}
+	if l == nil {
+		return events, nil
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	l.mu.Lock()
+	paths := []string{l.path}
+	for i := 1; i <= l.maxFiles; i++ {
+		paths = append(paths, l.rotated(i))
+	}
+	l.mu.Unlock()
+
+	done := false
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) && i > 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		err = scanBackward(f, func(line []byte) bool {
+			var e Event
+			if json.Unmarshal(line, &e) != nil {
+				return true
+			}
+			if !q.Since.IsZero() && e.Time.Before(q.Since) {
+				done = true
+				return false
+			}
+			if q.Matches(e) {
+				events = append(events, e)
+			}
+			done = len(events) >= limit
+			return !done
+		})
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if done {
+			break
+		}
+	}
+	return events, nil
+}
+
+// scanChunk is the block size scanBackward reads
+const scanChunk = 64 * 1024
+
+// scanBackward calls fn with each line of f, last line first, until fn
+// returns false. Lines passed to fn are only valid during the call.
+func scanBackward(f *os.File, fn func(line []byte) bool) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, scanChunk)
+	// partial holds the start of a line whose beginning is not read yet
+	var partial []byte
+	for pos := info.Size(); pos > 0; {
+		n := min(int64(scanChunk), pos)
+		pos -= n
+		if _, err := f.ReadAt(buf[:n], pos); err != nil {
+			return err
+		}
+		data := append(buf[:n:n], partial...)
+		for {
+			i := bytes.LastIndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if line := data[i+1:]; len(line) > 0 && !fn(line) {
+				return nil
+			}
+			data = data[:i]
+		}
+		partial = append(partial[:0], data...)
+	}
+	if len(partial) > 0 {
+		fn(partial)
+	}
+	return nil
+}
+
+// Limiter lets one event per key through each interval and counts the
+// ones it holds back, for events clients can trigger at will
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	keys     map[string]*limited
+	now      func() time.Time
+}
+
+// limited is the state of one Limiter key
+type limited struct {
+	last       time.Time
+	suppressed int
+}
+
+// maxLimiterKeys bounds the memory of a Limiter; new keys beyond it are
+// held back until old ones expire
+const maxLimiterKeys = 10000
+
+// NewLimiter creates a limiter passing one event per key and interval
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval, keys: make(map[string]*limited), now: time.Now}
+}
+
+// Allow reports whether an event for key may be recorded, and how many
+// events for key were held back since the last one allowed
+func (l *Limiter) Allow(key string) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	k, ok := l.keys[key]
+	if !ok {
+		if len(l.keys) >= maxLimiterKeys {
+			for key, k := range l.keys {
+				if now.Sub(k.last) >= l.interval {
+					delete(l.keys, key)
+				}
+			}
+			if len(l.keys) >= maxLimiterKeys {
+				return false, 0
+			}
+		}
+		l.keys[key] = &limited{last: now}
+		return true, 0
+	}
+	if now.Sub(k.last) < l.interval {
+		k.suppressed++
+		return false, 0
+	}
+	suppressed := k.suppressed
+	k.last, k.suppressed = now, 0
+	return true, suppressed
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record adds n events with increasing times and details "0" to "n-1"
+func record(l *Log, n int, start time.Time) {
+	for i := 0; i < n; i++ {
+		l.Record(Event{Time: start.Add(time.Duration(i) * time.Second), Action: ActionLogin, Actor: "admin", Detail: fmt.Sprint(i)})
+	}
+}
+
+func details(events []Event) string {
+	var d []string
+	for _, e := range events {
+		d = append(d, e.Detail)
+	}
+	return strings.Join(d, ",")
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+	l.SetRotation(1024, 2)
+
+	record(l, 100, time.Unix(0, 0).UTC())
+	for _, name := range []string{FileName, FileName + ".1", FileName + ".2"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Size() >= 1024+200 {
+			t.Errorf("%s is %d bytes, want about 1024 at most", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName+".3")); !os.IsNotExist(err) {
+		t.Errorf("more rotated files than max_files kept: %v", err)
+	}
+
+	// Search reads on into rotated files, newest first
+	events, err := l.Search(Query{Limit: 20})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(events) != 20 || events[0].Detail != "99" || events[19].Detail != "80" {
+		t.Errorf("Search = %s, want 99 down to 80", details(events))
+	}
+	// Older events were rotated away
+	if events, _ := l.Search(Query{Limit: 100}); len(events) >= 50 {
+		t.Errorf("Search found %d events, want the rotated away ones gone", len(events))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+	start := time.Unix(1000, 0).UTC()
+	record(l, 10, start)
+	l.Record(Event{Time: start.Add(time.Minute), Action: ActionTokenDenied, IP: "192.0.2.1", Detail: "denied"})
+	// Lines longer than a read chunk and broken lines are handled
+	l.Record(Event{Time: start.Add(2 * time.Minute), Action: ActionConfigChange, Detail: strings.Repeat("x", 3*scanChunk)})
+	l.f.WriteString("{not json\n")
+
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"limit", Query{Limit: 3}, strings.Repeat("x", 3*scanChunk) + ",denied,9"},
+		{"action", Query{Action: ActionLogin, Limit: 2}, "9,8"},
+		{"action prefix", Query{Action: "token."}, "denied"},
+		{"ip", Query{IP: "192.0.2.1"}, "denied"},
+		{"since", Query{Action: ActionLogin, Since: start.Add(7 * time.Second)}, "9,8,7"},
+		{"until", Query{Action: ActionLogin, Until: start.Add(time.Second)}, "1,0"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := l.Search(tc.q)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if got := details(events); got != tc.want {
+				t.Errorf("Search = %.80s, want %.80s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(time.Minute)
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first event held back")
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.Allow("a"); ok {
+			t.Fatal("repeated event allowed within the interval")
+		}
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("event for another key held back")
+	}
+
+	now = now.Add(time.Minute)
+	if ok, suppressed := l.Allow("a"); !ok || suppressed != 5 {
+		t.Errorf("Allow = %v, %d; want true, 5", ok, suppressed)
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("event allowed right after the interval restarted")
+	}
+}
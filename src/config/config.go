@@ -7,7 +7,7 @@ import (
 	"strings"
 	"sync"
 
-	"gopkg.in/yaml.v3"
+	"github.com/apimgr/gitmessages/src/logging"
 )
 
 // Config represents the complete server configuration
@@ -20,27 +20,114 @@ type Config struct {
 
 // ServerConfig contains server-related settings
 type ServerConfig struct {
-	Port         string        `yaml:"port"`
-	FQDN         string        `yaml:"fqdn"`
-	Address      string        `yaml:"address"`
-	Mode         string        `yaml:"mode"`
-	UpdateBranch string        `yaml:"update_branch"`
-	Metrics      MetricsConfig `yaml:"metrics"`
-	Logging      LoggingConfig `yaml:"logging"`
-	Admin        AdminConfig   `yaml:"admin"`
-	Session      SessionConfig `yaml:"session"`
+	Port             string        `yaml:"port"`
+	FQDN             string        `yaml:"fqdn"`
+	Address          string        `yaml:"address"`
+	TrustedProxies   []string      `yaml:"trusted_proxies"`
+	SocketMode       string        `yaml:"socket_mode"`
+	SocketActivation bool          `yaml:"socket_activation"`
+	Mode             string        `yaml:"mode"`
+	UpdateBranch     string        `yaml:"update_branch"`
+	Metrics          MetricsConfig `yaml:"metrics"`
+	Logging          LoggingConfig `yaml:"logging"`
+	Admin            AdminConfig   `yaml:"admin"`
+	Session          SessionConfig `yaml:"session"`
+	SSL              SSLConfig     `yaml:"ssl"`
+	HTTP             HTTPConfig    `yaml:"http"`
+	Watch            WatchConfig   `yaml:"watch"`
+}
+
+// WatchConfig controls automatic reload when the config file changes
+type WatchConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"`
+}
+
+// HTTPConfig contains HTTP server tuning; timeouts are in seconds
+type HTTPConfig struct {
+	ReadTimeout        int  `yaml:"read_timeout"`
+	ReadHeaderTimeout  int  `yaml:"read_header_timeout"`
+	WriteTimeout       int  `yaml:"write_timeout"`
+	IdleTimeout        int  `yaml:"idle_timeout"`
+	MaxHeaderBytes     int  `yaml:"max_header_bytes"`
+	H2C                bool `yaml:"h2c"`
+	KeepAlive          bool `yaml:"keep_alive"`
+	MaxRequestsPerConn int  `yaml:"max_requests_per_conn"`
+}
+
+// SSLConfig contains SSL/TLS settings
+type SSLConfig struct {
+	Enabled      bool              `yaml:"enabled"`
+	CertPath     string            `yaml:"cert_path"`
+	RedirectHTTP bool              `yaml:"redirect_http"`
+	HSTS         HSTSConfig        `yaml:"hsts"`
+	LetsEncrypt  LetsEncryptConfig `yaml:"letsencrypt"`
+}
+
+// HSTSConfig contains Strict-Transport-Security settings
+type HSTSConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	MaxAge            int  `yaml:"max_age"`
+	IncludeSubdomains bool `yaml:"include_subdomains"`
+	Preload           bool `yaml:"preload"`
+}
+
+// LetsEncryptConfig contains Let's Encrypt settings
+type LetsEncryptConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Email          string `yaml:"email"`
+	Challenge      string `yaml:"challenge"`
+	DirectoryURL   string `yaml:"directory_url"`
+	CABundle       string `yaml:"ca_bundle"`
+	DNSProvider    string `yaml:"dns_provider"`
+	DNSProviderKey string `yaml:"dns_provider_key"`
+	RFC2136Server  string `yaml:"rfc2136_server"`
+	RFC2136Zone    string `yaml:"rfc2136_zone"`
+	RFC2136Name    string `yaml:"rfc2136_name"`
+	RFC2136Algo    string `yaml:"rfc2136_algo"`
 }
 
 // AdminConfig contains admin authentication settings
 type AdminConfig struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	APIToken string `yaml:"api_token"`
+	Username     string        `yaml:"username"`
+	Password     string        `yaml:"password"`
+	PasswordFile string        `yaml:"password_file"`
+	APIToken     string        `yaml:"api_token"`
+	APITokenFile string        `yaml:"api_token_file"`
+	Lockout      LockoutConfig `yaml:"lockout"`
+	Argon2       Argon2Config  `yaml:"argon2"`
+}
+
+// Argon2Config is the cost of new admin password hashes. Memory is in KiB.
+// Hashes made with other parameters keep working and are upgraded at the
+// next successful login.
+type Argon2Config struct {
+	Memory      int `yaml:"memory"`
+	Iterations  int `yaml:"iterations"`
+	Parallelism int `yaml:"parallelism"`
+}
+
+// LockoutConfig limits admin login attempts per client IP and per username.
+// Each failure doubles the wait before the next attempt, from base_delay up
+// to max_delay; max_failures within window locks the client IP out for
+// duration. Usernames only get the delay, so failures from other clients
+// cannot lock the admin out. Times are in seconds and max_failures 0
+// disables the lockout.
+type LockoutConfig struct {
+	MaxFailures int `yaml:"max_failures"`
+	Window      int `yaml:"window"`
+	Duration    int `yaml:"duration"`
+	BaseDelay   int `yaml:"base_delay"`
+	MaxDelay    int `yaml:"max_delay"`
 }
 
-// SessionConfig contains session settings
+// SessionConfig contains admin session settings. Store is "file" to keep
+// sessions in the data directory across restarts, or "memory".
 type SessionConfig struct {
-	Timeout int `yaml:"timeout"`
+	Timeout       int    `yaml:"timeout"`
+	Store         string `yaml:"store"`
+	BindIP        bool   `yaml:"bind_ip"`
+	BindUserAgent bool   `yaml:"bind_user_agent"`
 }
 
 // MetricsConfig contains metrics settings
@@ -53,8 +140,16 @@ type MetricsConfig struct {
 
 // LoggingConfig contains logging settings
 type LoggingConfig struct {
-	AccessFormat string `yaml:"access_format"`
-	Level        string `yaml:"level"`
+	AccessFormat string         `yaml:"access_format"`
+	Level        string         `yaml:"level"`
+	Audit        AuditLogConfig `yaml:"audit"`
+}
+
+// AuditLogConfig limits the disk used by the audit log. Past max_size MiB
+// it is rotated, keeping max_files old files; max_size 0 never rotates.
+type AuditLogConfig struct {
+	MaxSize  int `yaml:"max_size"`
+	MaxFiles int `yaml:"max_files"`
 }
 
 // WebUIConfig contains web UI settings
@@ -87,17 +182,20 @@ var (
 	current    *Config
 	mu         sync.RWMutex
 	configPath string
+	files      []string
 )
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         "",
-			FQDN:         "",
-			Address:      "0.0.0.0",
-			Mode:         "production",
-			UpdateBranch: "stable",
+			Port:           "",
+			FQDN:           "",
+			Address:        "0.0.0.0",
+			TrustedProxies: []string{},
+			SocketMode:     "0660",
+			Mode:           "production",
+			UpdateBranch:   "stable",
 			Metrics: MetricsConfig{
 				Enabled:       false,
 				Endpoint:      "/metrics",
@@ -107,14 +205,61 @@ func DefaultConfig() *Config {
 			Logging: LoggingConfig{
 				AccessFormat: "apache",
 				Level:        "info",
+				Audit: AuditLogConfig{
+					MaxSize:  10,
+					MaxFiles: 5,
+				},
 			},
 			Admin: AdminConfig{
 				Username: "admin",
 				Password: "",
 				APIToken: "",
+				Lockout: LockoutConfig{
+					MaxFailures: 5,
+					Window:      900,
+					Duration:    900,
+					BaseDelay:   1,
+					MaxDelay:    30,
+				},
+				Argon2: Argon2Config{
+					Memory:      65536,
+					Iterations:  3,
+					Parallelism: 4,
+				},
 			},
 			Session: SessionConfig{
 				Timeout: 3600,
+				Store:   "file",
+			},
+			SSL: SSLConfig{
+				Enabled:      false,
+				CertPath:     "",
+				RedirectHTTP: false,
+				HSTS: HSTSConfig{
+					Enabled:           true,
+					MaxAge:            63072000,
+					IncludeSubdomains: false,
+					Preload:           false,
+				},
+				LetsEncrypt: LetsEncryptConfig{
+					Enabled:   false,
+					Email:     "",
+					Challenge: "http-01",
+				},
+			},
+			HTTP: HTTPConfig{
+				ReadTimeout:        15,
+				ReadHeaderTimeout:  5,
+				WriteTimeout:       15,
+				IdleTimeout:        60,
+				MaxHeaderBytes:     1 << 20,
+				H2C:                false,
+				KeepAlive:          true,
+				MaxRequestsPerConn: 0,
+			},
+			Watch: WatchConfig{
+				Enabled:  false,
+				Interval: 2,
 			},
 		},
 		WebUI: WebUIConfig{
@@ -156,7 +301,8 @@ func migrateYamlToYml(path string) {
 	}
 }
 
-// Load loads configuration from a YAML file
+// Load loads configuration from path, or from server.toml or server.json
+// next to it when no YAML file exists, merged with its includes
 func Load(path string) (*Config, error) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -164,31 +310,84 @@ func Load(path string) (*Config, error) {
 	// Migrate old .yaml to .yml if needed
 	migrateYamlToYml(path)
 
+	path, ignored := resolveConfigPath(path)
+	for _, f := range ignored {
+		logging.Warnf("ignoring %s, %s takes precedence", f, path)
+	}
 	configPath = path
 
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		cfg := DefaultConfig()
-		if err := saveConfig(cfg, path); err != nil {
+		if err := saveConfig(DefaultConfig(), path); err != nil {
 			return nil, fmt.Errorf("failed to create default config: %w", err)
 		}
-		current = cfg
-		return cfg, nil
 	}
 
-	data, err := os.ReadFile(path)
+	docs, problems, err := readDocuments(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Path: path, Problems: problems}
+	}
+	cfg, err := decodeDocuments(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save writes only what came from the main file
+	fileCfg := DefaultConfig()
+	docs[0].node.Decode(fileCfg)
+
+	overridden, err := applyOverrides(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
+	resolved, err := resolveSecrets(cfg)
+	if err != nil {
+		return nil, err
+	}
+	appliedCfg := *cfg
 
-	cfg := DefaultConfig()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	srcs := fileSources(docs)
+	for key, src := range overridden {
+		srcs[key] = src
+	}
+	for key, src := range resolved {
+		srcs[key] = src
 	}
 
+	files = files[:0]
+	for _, d := range docs {
+		files = append(files, d.path)
+	}
+	files = append(files, filepath.Join(filepath.Dir(path), confDirName))
+
+	base, applied, sources = fileCfg, &appliedCfg, srcs
 	current = cfg
 	return cfg, nil
 }
 
+// Verify re-reads the configuration files and reports whether they still
+// parse
+func Verify() error {
+	mu.RLock()
+	path := configPath
+	mu.RUnlock()
+	if path == "" {
+		return fmt.Errorf("no configuration loaded")
+	}
+
+	docs, problems, err := readDocuments(path)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("failed to parse config file: %s", problems[0])
+	}
+	_, err = decodeDocuments(docs)
+	return err
+}
+
 // Get returns the current configuration
 func Get() *Config {
 	mu.RLock()
@@ -206,94 +405,7 @@ func Save() error {
 	if current == nil || configPath == "" {
 		return fmt.Errorf("no configuration loaded")
 	}
-	return saveConfig(current, configPath)
-}
-
-// saveConfig writes configuration to a YAML file
-func saveConfig(cfg *Config, path string) error {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
-
-	content := generateConfigYAML(cfg)
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
-	}
-
-	return nil
-}
-
-// generateConfigYAML generates YAML content with comments
-func generateConfigYAML(cfg *Config) string {
-	return fmt.Sprintf(`# GitMessages Server Configuration
-# Documentation: https://gitmessages.apimgr.us/docs
-
-server:
-  port: "%s"
-  fqdn: "%s"
-  address: "%s"
-
-  metrics:
-    enabled: %t
-    endpoint: "%s"
-    include_system: %t
-    include_app: %t
-
-  logging:
-    access_format: "%s"
-    level: "%s"
-
-web-ui:
-  theme: "%s"
-  logo: "%s"
-  favicon: "%s"
-  notifications:
-    enabled: %t
-    announcements: %s
-
-web-robots:
-  allow: %s
-  deny: %s
-
-web-security:
-  admin: "%s"
-  cors: "%s"
-`,
-		cfg.Server.Port,
-		cfg.Server.FQDN,
-		cfg.Server.Address,
-		cfg.Server.Metrics.Enabled,
-		cfg.Server.Metrics.Endpoint,
-		cfg.Server.Metrics.IncludeSystem,
-		cfg.Server.Metrics.IncludeApp,
-		cfg.Server.Logging.AccessFormat,
-		cfg.Server.Logging.Level,
-		cfg.WebUI.Theme,
-		cfg.WebUI.Logo,
-		cfg.WebUI.Favicon,
-		cfg.WebUI.Notifications.Enabled,
-		formatStringSlice(cfg.WebUI.Notifications.Announcements),
-		formatStringSlice(cfg.WebRobots.Allow),
-		formatStringSlice(cfg.WebRobots.Deny),
-		cfg.WebSecurity.Admin,
-		cfg.WebSecurity.CORS,
-	)
-}
-
-func formatStringSlice(s []string) string {
-	if len(s) == 0 {
-		return "[]"
-	}
-	result := "["
-	for i, v := range s {
-		if i > 0 {
-			result += ", "
-		}
-		result += fmt.Sprintf("\"%s\"", v)
-	}
-	result += "]"
-	return result
+	return saveConfig(withoutOverrides(current), configPath)
 }
 
 // GetTheme returns the current theme
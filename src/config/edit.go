@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Edit sets configuration keys to values in the syntax of --set: plain
+// strings, numbers and booleans, or lists as YAML flow sequences such as
+// ["a", "b"]
+type Edit map[string]string
+
+// fileOwned reports an error when the effective value of key comes from an
+// include, the environment, --set or a secret reference, so writing it to
+// the main config file would have no effect. Callers hold mu.
+func fileOwned(key string) error {
+	if src, ok := sources[key]; ok && src != configPath && !strings.HasPrefix(src, configPath+":") {
+		return fmt.Errorf("%s is set by %s, not %s", key, src, configPath)
+	}
+	return nil
+}
+
+// Locked reports whether key is set outside the main config file, so it
+// cannot be edited there, and by what
+func Locked(key string) (string, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if err := fileOwned(key); err != nil {
+		return sources[key], true
+	}
+	return "", false
+}
+
+// editedConfig applies edit to a copy of the current configuration and
+// checks the main file it would produce together with its includes. It
+// returns the new configuration, its main file and the changes. Callers
+// hold mu.
+func editedConfig(edit Edit) (*Config, []byte, []Change, error) {
+	if current == nil || configPath == "" {
+		return nil, nil, nil, fmt.Errorf("no configuration loaded")
+	}
+
+	keys := make([]string, 0, len(edit))
+	for key := range edit {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	next := *current
+	var problems []Problem
+	for _, key := range keys {
+		if err := fileOwned(key); err != nil {
+			problems = append(problems, Problem{Key: key, Message: err.Error()})
+			continue
+		}
+		if err := setKey(&next, key, edit[key]); err != nil {
+			problems = append(problems, Problem{Key: key, Message: err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, nil, nil, &ValidationError{Path: configPath, Problems: problems}
+	}
+
+	data, err := renderConfig(withoutOverrides(&next), configPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	docs, problems, err := readDocuments(configPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(problems) == 0 {
+		doc, err := parseDocument(configPath, data)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to encode config: %w", err)
+		}
+		docs[0].node = doc.Content[0]
+		problems = validateDocuments(docs)
+		// Lines of the main file refer to the edited version, which the
+		// user has not seen
+		for i := range problems {
+			if problems[i].File == "" {
+				problems[i].Line, problems[i].Column = 0, 0
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, nil, nil, &ValidationError{Path: configPath, Problems: problems}
+	}
+	return &next, data, Diff(current, &next), nil
+}
+
+// PreviewEdit returns the changes edit would make without saving them.
+// Invalid values are reported as a *ValidationError.
+func PreviewEdit(edit Edit) ([]Change, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, _, changes, err := editedConfig(edit)
+	return changes, err
+}
+
+// ApplyEdit validates edit, writes it to the main config file and reloads,
+// so subscribers apply the changes at once. Nothing is written when the
+// result is invalid or nothing changes.
+func ApplyEdit(edit Edit) ([]Change, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	mu.Lock()
+	_, data, changes, err := editedConfig(edit)
+	if err == nil && len(changes) > 0 {
+		err = writeConfig(configPath, data)
+	}
+	mu.Unlock()
+	if err != nil || len(changes) == 0 {
+		return changes, err
+	}
+	return reload()
+}
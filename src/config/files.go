@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported config file formats, in order of precedence when several
+// server.* files exist side by side
+var formatExtensions = []string{".yml", ".toml", ".json"}
+
+// includeKey is the top-level key listing extra config files to merge
+const includeKey = "include"
+
+// confDirName is the drop-in directory next to the main config file
+const confDirName = "conf.d"
+
+// ResolvePath returns the config file actually used for path, which names
+// the YAML file; see resolveConfigPath
+func ResolvePath(path string) string {
+	resolved, _ := resolveConfigPath(path)
+	return resolved
+}
+
+// document is one parsed config file
+type document struct {
+	path string
+	node *yaml.Node
+}
+
+// resolveConfigPath picks the config file to use for path ("server.yml"):
+// server.yml, then server.toml, then server.json. The YAML name is kept
+// when none exists so a default file can be created.
+func resolveConfigPath(path string) (string, []string) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+
+	var found []string
+	for _, e := range formatExtensions {
+		if _, err := os.Stat(stem + e); err == nil {
+			found = append(found, stem+e)
+		}
+	}
+	if len(found) == 0 {
+		return path, nil
+	}
+	return found[0], found[1:]
+}
+
+// parseDocument parses config data in the format given by the file name
+// into a YAML document node. JSON is parsed as YAML so problems keep their
+// line numbers; TOML is converted and has no per-key lines.
+func parseDocument(path string, data []byte) (*yaml.Node, error) {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		var m map[string]interface{}
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, err
+		}
+		converted, err := yaml.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		var root yaml.Node
+		if err := yaml.Unmarshal(converted, &root); err != nil {
+			return nil, err
+		}
+		clearLines(&root)
+		return ensureRoot(&root), nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	return ensureRoot(&root), nil
+}
+
+// ensureRoot gives an empty document an empty top-level mapping
+func ensureRoot(doc *yaml.Node) *yaml.Node {
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	return doc
+}
+
+// clearLines drops line numbers that refer to converted rather than
+// original content
+func clearLines(n *yaml.Node) {
+	n.Line, n.Column = 0, 0
+	for _, c := range n.Content {
+		clearLines(c)
+	}
+}
+
+// parseProblems converts a parse error into problems for file
+func parseProblems(file string, err error) []Problem {
+	var perr toml.ParseError
+	if errors.As(err, &perr) {
+		return []Problem{{File: file, Line: perr.Position.Line, Message: perr.Message}}
+	}
+	problems := yamlProblems(err)
+	for i := range problems {
+		problems[i].File = file
+	}
+	return problems
+}
+
+// readDocuments reads the main config file, its include: entries and the
+// conf.d directory, in merge order. Unreadable or unparseable files are
+// reported as problems.
+func readDocuments(path string) ([]document, []Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	doc, err := parseDocument(path, data)
+	if err != nil {
+		return nil, parseProblems("", err), nil
+	}
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, []Problem{{Line: node.Line, Message: "expected a mapping at the top level"}}, nil
+	}
+	docs := []document{{path: path, node: node}}
+
+	files, problems := includedFiles(path, node)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			problems = append(problems, Problem{File: f, Message: err.Error()})
+			continue
+		}
+		doc, err := parseDocument(f, data)
+		if err != nil {
+			problems = append(problems, parseProblems(f, err)...)
+			continue
+		}
+		node := doc.Content[0]
+		if node.Kind != yaml.MappingNode {
+			problems = append(problems, Problem{File: f, Line: node.Line, Message: "expected a mapping at the top level"})
+			continue
+		}
+		docs = append(docs, document{path: f, node: node})
+	}
+	return docs, problems, nil
+}
+
+// includedFiles lists the files named by include: (relative to the main
+// file, globs allowed) followed by conf.d/*, each group in lexical order
+func includedFiles(path string, root *yaml.Node) ([]string, []Problem) {
+	dir := filepath.Dir(path)
+	var files []string
+	var problems []Problem
+
+	if inc := mappingValue(root, includeKey); inc != nil {
+		var patterns []string
+		if inc.Kind == yaml.ScalarNode {
+			patterns = []string{inc.Value}
+		} else if err := inc.Decode(&patterns); err != nil {
+			problems = append(problems, Problem{Line: inc.Line, Key: includeKey, Message: "expected a file name or a list of file names"})
+		}
+		for _, p := range patterns {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			matches, err := filepath.Glob(p)
+			if err != nil || len(matches) == 0 {
+				problems = append(problems, Problem{Line: inc.Line, Key: includeKey, Message: fmt.Sprintf("no files match %q", p)})
+				continue
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, confDirName))
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if ext == ".yml" || ext == ".yaml" || ext == ".toml" || ext == ".json" {
+			files = append(files, filepath.Join(dir, confDirName, e.Name()))
+		}
+	}
+	return files, problems
+}
+
+// mergeDocuments deep-merges documents in order; later values win
+func mergeDocuments(docs []document) *yaml.Node {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, d := range docs {
+		mergeInto(merged, d.node)
+	}
+	return merged
+}
+
+// mergeInto merges mapping src into dst. dst only ever holds copies, so
+// the source documents are left untouched.
+func mergeInto(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if key.Value == includeKey {
+			continue
+		}
+		existing := mappingValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, copyNode(key), copyNode(value))
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeInto(existing, value)
+		default:
+			*existing = *copyNode(value)
+		}
+	}
+}
+
+// copyNode returns a deep copy of a node
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// decodeDocuments decodes the merged documents over the defaults
+func decodeDocuments(docs []document) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := mergeDocuments(docs).Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// encodeDocument renders a config document in the format of path. Comments
+// are only kept for YAML.
+func encodeDocument(path string, doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".toml":
+		var m map[string]interface{}
+		if err := doc.Decode(&m); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			enc := json.NewEncoder(&buf)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(m); err != nil {
+				return nil, err
+			}
+		} else {
+			enc := toml.NewEncoder(&buf)
+			enc.Indent = ""
+			if err := enc.Encode(m); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		enc.Close()
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// EnvPrefix is the prefix of environment variables that override config
+// keys, e.g. GITMESSAGES_SERVER_SSL_ENABLED for server.ssl.enabled
+const EnvPrefix = "GITMESSAGES_"
+
+// Value sources reported by Sources
+const (
+	SourceDefault = "default"
+	SourceFlag    = "--set"
+)
+
+// Override sets one configuration key from the environment or command line
+type Override struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Override state, guarded by mu. base is the main config file alone and
+// applied the configuration after includes and overrides at the last Load;
+// Save uses them to keep included and overridden values out of the file.
+var (
+	overrides []Override
+	base      *Config
+	applied   *Config
+	sources   map[string]string
+)
+
+// Keys returns the dotted path of every configuration setting
+func Keys() []string {
+	var keys []string
+	collectKeys(reflect.TypeOf(Config{}), "", &keys)
+	return keys
+}
+
+// collectKeys appends the leaf keys of a struct type
+func collectKeys(t reflect.Type, prefix string, keys *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		tag := yamlTag(t.Field(i))
+		if tag == "" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			collectKeys(t.Field(i).Type, key, keys)
+		} else {
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+// EnvName returns the environment variable that overrides key
+func EnvName(key string) string {
+	r := strings.NewReplacer(".", "_", "-", "_")
+	return EnvPrefix + strings.ToUpper(r.Replace(key))
+}
+
+// SetOverrides parses GITMESSAGES_* variables from environ and key=value
+// pairs from --set flags. They are applied by every Load, flags last.
+func SetOverrides(environ, sets []string) error {
+	envKeys := make(map[string]string)
+	for _, key := range Keys() {
+		envKeys[EnvName(key)] = key
+	}
+
+	var parsed []Override
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key, known := envKeys[name]
+		if !known {
+			logging.Warnf("ignoring %s: no such configuration key", name)
+			continue
+		}
+		parsed = append(parsed, Override{Key: key, Value: value, Source: name})
+	}
+	// Environment order is arbitrary; keep the output stable
+	sort.Slice(parsed, func(i, j int) bool { return parsed[i].Key < parsed[j].Key })
+
+	for _, kv := range sets {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("invalid --set %q: expected key=value", kv)
+		}
+		parsed = append(parsed, Override{Key: strings.TrimSpace(key), Value: value, Source: SourceFlag})
+	}
+
+	// Check every override against a scratch config before accepting any
+	scratch := DefaultConfig()
+	for _, o := range parsed {
+		if err := setKey(scratch, o.Key, o.Value); err != nil {
+			return fmt.Errorf("%s: %w", o.Source, err)
+		}
+	}
+
+	mu.Lock()
+	overrides = parsed
+	mu.Unlock()
+	return nil
+}
+
+// applyOverrides applies the overrides to cfg and returns the source of
+// every key that was overridden
+func applyOverrides(cfg *Config) (map[string]string, error) {
+	srcs := make(map[string]string)
+	for _, o := range overrides {
+		if err := setKey(cfg, o.Key, o.Value); err != nil {
+			return nil, fmt.Errorf("%s: %w", o.Source, err)
+		}
+		srcs[o.Key] = o.Source
+	}
+	return srcs, nil
+}
+
+// fileSources returns "path:line" for every key set in a config file; later
+// files win, as they do when merging
+func fileSources(docs []document) map[string]string {
+	srcs := make(map[string]string)
+	for _, d := range docs {
+		v := &validator{nodes: make(map[string]*yaml.Node)}
+		v.walk(d.node, reflect.TypeOf(Config{}), "")
+		for key, node := range v.nodes {
+			if node.Line > 0 {
+				srcs[key] = fmt.Sprintf("%s:%d", d.path, node.Line)
+			} else {
+				srcs[key] = d.path
+			}
+		}
+	}
+	return srcs
+}
+
+// Sources returns where the effective value of every key came from: the
+// config file and line, an environment variable, --set or the default
+func Sources() map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	result := make(map[string]string)
+	for _, key := range Keys() {
+		result[key] = SourceDefault
+		if src, ok := sources[key]; ok {
+			result[key] = src
+		}
+	}
+	return result
+}
+
+// withoutOverrides returns a copy of cfg with overridden keys, included
+// values and resolved secrets reset to their main file values, unless they
+// were changed since Load
+func withoutOverrides(cfg *Config) *Config {
+	out := *cfg
+	if base == nil || applied == nil {
+		return &out
+	}
+	for _, key := range Keys() {
+		cur, _ := lookupKey(cfg, key)
+		loaded, _ := lookupKey(applied, key)
+		orig, _ := lookupKey(base, key)
+		if reflect.DeepEqual(loaded.Interface(), orig.Interface()) {
+			continue
+		}
+		if reflect.DeepEqual(cur.Interface(), loaded.Interface()) {
+			field, _ := lookupKey(&out, key)
+			field.Set(orig)
+		}
+	}
+	return &out
+}
+
+// GetKey returns the value of a key
+func GetKey(cfg *Config, key string) (interface{}, error) {
+	field, ok := lookupKey(cfg, key)
+	if !ok {
+		return nil, fmt.Errorf("unknown configuration key %q", key)
+	}
+	return field.Interface(), nil
+}
+
+// SetFileValue changes key in the current configuration and writes it to
+// the main config file. It fails when the value comes from an include, the
+// environment, --set or a secret reference, which the file cannot change.
+func SetFileValue(key, value string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil || configPath == "" {
+		return fmt.Errorf("no configuration loaded")
+	}
+	if err := fileOwned(key); err != nil {
+		return err
+	}
+
+	next := *current
+	if err := setKey(&next, key, value); err != nil {
+		return err
+	}
+	if err := saveConfig(withoutOverrides(&next), configPath); err != nil {
+		return err
+	}
+	if base != nil && applied != nil {
+		b, a := *base, *applied
+		setKey(&b, key, value)
+		setKey(&a, key, value)
+		base, applied = &b, &a
+	}
+	current = &next
+	return nil
+}
+
+// setKey parses value into the field for key. Lists accept YAML flow
+// syntax ("[a, b]") or comma-separated values.
+func setKey(cfg *Config, key, value string) error {
+	field, ok := lookupKey(cfg, key)
+	if !ok {
+		return fmt.Errorf("unknown configuration key %q", key)
+	}
+
+	if field.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+
+	ptr := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return fmt.Errorf("invalid value %q for %s (expected %s)", value, key, field.Type())
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// lookupKey returns the settable field for a dotted key
+func lookupKey(cfg *Config, key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if yamlTag(v.Type().Field(i)) == part {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+	if v.Kind() == reflect.Struct {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// yamlTag returns the YAML key of a struct field
+func yamlTag(f reflect.StructField) string {
+	tag := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if tag == "-" {
+		return ""
+	}
+	return tag
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Change describes one setting that differs between two configurations.
+// Secret values are masked.
+type Change struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// String formats the change as "key: old -> new"
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Key, c.Old, c.New)
+}
+
+// Subscriber is called after a reload with the previous and the new
+// configuration and the settings that changed
+type Subscriber func(old, new *Config, changes []Change)
+
+var (
+	subMu       sync.Mutex
+	subscribers []Subscriber
+	// reloadMu serialises reloads from signals, the API and the watcher
+	reloadMu sync.Mutex
+)
+
+// Subscribe registers fn to be called after every successful reload
+func Subscribe(fn Subscriber) {
+	subMu.Lock()
+	defer subMu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+// Reload validates and re-reads the configuration file, makes it current
+// and notifies subscribers. An invalid file leaves the running
+// configuration untouched.
+func Reload() ([]Change, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return reload()
+}
+
+// reload does the work of Reload. Callers hold reloadMu.
+func reload() ([]Change, error) {
+	mu.RLock()
+	path := configPath
+	mu.RUnlock()
+	if path == "" {
+		return nil, fmt.Errorf("no configuration loaded")
+	}
+
+	problems, err := ValidateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Path: path, Problems: problems}
+	}
+
+	old := Get()
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Diff(old, cfg)
+	for _, c := range changes {
+		log.Printf("Config: %s", c)
+	}
+
+	subMu.Lock()
+	subs := append([]Subscriber(nil), subscribers...)
+	subMu.Unlock()
+	for _, fn := range subs {
+		fn(old, cfg, changes)
+	}
+	return changes, nil
+}
+
+// Diff returns the settings that differ between a and b
+func Diff(a, b *Config) []Change {
+	var changes []Change
+	for _, key := range Keys() {
+		va, _ := GetKey(a, key)
+		vb, _ := GetKey(b, key)
+		if reflect.DeepEqual(va, vb) {
+			continue
+		}
+		if IsSecretKey(key) {
+			va, vb = maskSecret(va), maskSecret(vb)
+		}
+		changes = append(changes, Change{Key: key, Old: va, New: vb})
+	}
+	return changes
+}
+
+// IsSecretKey reports whether a config key holds a credential
+func IsSecretKey(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	if strings.HasSuffix(name, "_file") {
+		return false
+	}
+	return strings.Contains(name, "password") || strings.Contains(name, "token") || strings.HasSuffix(name, "_key")
+}
+
+// maskSecret hides a secret value while showing whether it is set
+func maskSecret(v interface{}) interface{} {
+	if s, ok := v.(string); ok && s != "" {
+		return "********"
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvRefPrefix marks a secret that is read from an environment variable,
+// e.g. password: "env:GITMESSAGES_ADMIN_PASSWORD"
+const EnvRefPrefix = "env:"
+
+// resolveSecrets replaces admin credentials that reference a file or an
+// environment variable with their value and returns where each came from
+func resolveSecrets(cfg *Config) (map[string]string, error) {
+	srcs := make(map[string]string)
+	admin := &cfg.Server.Admin
+
+	secrets := []struct {
+		key      string
+		value    *string
+		fileKey  string
+		filePath string
+	}{
+		{"server.admin.password", &admin.Password, "server.admin.password_file", admin.PasswordFile},
+		{"server.admin.api_token", &admin.APIToken, "server.admin.api_token_file", admin.APITokenFile},
+	}
+
+	for _, s := range secrets {
+		if s.filePath != "" {
+			if *s.value != "" {
+				return nil, fmt.Errorf("%s and %s are both set", s.key, s.fileKey)
+			}
+			value, err := readSecretFile(s.filePath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", s.fileKey, err)
+			}
+			*s.value = value
+			srcs[s.key] = "file " + s.filePath
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(*s.value, EnvRefPrefix); ok {
+			value, set := os.LookupEnv(name)
+			if !set {
+				return nil, fmt.Errorf("%s: environment variable %s is not set", s.key, name)
+			}
+			*s.value = value
+			srcs[s.key] = "env " + name
+		}
+	}
+	return srcs, nil
+}
+
+// readSecretFile reads a secret such as a Docker or Kubernetes secret
+// mount, dropping the trailing newline most tools add
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return value, nil
+}
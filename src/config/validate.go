@@ -0,0 +1,471 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem describes one invalid setting in a configuration file. File is
+// only set for included files.
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Key     string
+	Message string
+}
+
+// String formats the problem as "line N: key: message", prefixed with the
+// file name for included files
+func (p Problem) String() string {
+	var b strings.Builder
+	switch {
+	case p.File != "" && p.Line > 0:
+		fmt.Fprintf(&b, "%s:%d: ", p.File, p.Line)
+	case p.File != "":
+		fmt.Fprintf(&b, "%s: ", p.File)
+	case p.Line > 0:
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+	if p.Key != "" {
+		fmt.Fprintf(&b, "%s: ", p.Key)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ValidationError reports every problem found in a configuration file
+type ValidationError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("%s: %d configuration problem(s)", e.Path, len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Valid setting values
+var (
+	validModes         = []string{"production", "prod", "development", "dev"}
+	validThemes        = []string{"dark", "light", "auto"}
+	validAccessFormats = []string{"apache", "json"}
+	validLogLevels     = []string{"debug", "info", "warn", "error"}
+	validChallenges    = []string{"http-01", "tls-alpn-01", "dns-01"}
+	validSessionStores = []string{"file", "memory"}
+)
+
+// yamlLineRe extracts the line number from yaml.v3 error messages
+var yamlLineRe = regexp.MustCompile(`line (\d+): (.*)`)
+
+// ValidateFile checks a configuration file, its includes and conf.d files
+// and returns every problem found. An error is only returned when the main
+// file cannot be read.
+func ValidateFile(path string) ([]Problem, error) {
+	path, _ = resolveConfigPath(path)
+	docs, problems, err := readDocuments(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) > 0 {
+		problems = append(problems, validateDocuments(docs)...)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+// Validate checks YAML configuration data: syntax, unknown keys, types and
+// setting values, with the line number of each problem
+func Validate(data []byte) []Problem {
+	doc, err := parseDocument("server.yml", data)
+	if err != nil {
+		return parseProblems("", err)
+	}
+	return validateDocuments([]document{{node: doc.Content[0]}})
+}
+
+// validateDocuments checks the documents of a configuration; the first is
+// the main file
+func validateDocuments(docs []document) []Problem {
+	v := &validator{
+		nodes: make(map[string]*yaml.Node),
+		files: make(map[string]string),
+	}
+
+	for i, d := range docs {
+		v.file = ""
+		if i > 0 {
+			v.file = d.path
+		}
+		v.walk(d.node, reflect.TypeOf(Config{}), "")
+
+		// Report type errors against the file they are in
+		if err := d.node.Decode(DefaultConfig()); err != nil {
+			for _, p := range yamlProblems(err) {
+				p.File = v.file
+				v.problems = append(v.problems, p)
+			}
+		}
+	}
+
+	// Type errors still decode every other value, so keep checking
+	cfg := DefaultConfig()
+	if err := mergeDocuments(docs).Decode(cfg); err != nil {
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return v.problems
+		}
+	}
+	v.checkValues(cfg)
+	return v.problems
+}
+
+// yamlProblems converts yaml.v3 syntax and type errors into problems
+func yamlProblems(err error) []Problem {
+	var msgs []string
+	if te, ok := err.(*yaml.TypeError); ok {
+		msgs = te.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	problems := make([]Problem, 0, len(msgs))
+	for _, msg := range msgs {
+		p := Problem{Message: msg}
+		if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Message = m[2]
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// validator collects problems while walking the YAML document
+type validator struct {
+	nodes    map[string]*yaml.Node
+	files    map[string]string
+	file     string
+	problems []Problem
+}
+
+// add records a problem for the value at key
+func (v *validator) add(key, format string, args ...interface{}) {
+	p := Problem{Key: key, Message: fmt.Sprintf(format, args...)}
+	if n, ok := v.nodes[key]; ok {
+		p.File, p.Line, p.Column = v.files[key], n.Line, n.Column
+	}
+	v.problems = append(v.problems, p)
+}
+
+// walk records the node of every known key and reports unknown keys
+func (v *validator) walk(node *yaml.Node, t reflect.Type, prefix string) {
+	if node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct {
+		return
+	}
+
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		if tag := yamlTag(t.Field(i)); tag != "" {
+			fields[tag] = t.Field(i).Type
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if prefix == "" && keyNode.Value == includeKey {
+			continue
+		}
+		ft, ok := fields[keyNode.Value]
+		if !ok {
+			msg := "unknown key"
+			if s := closestKey(keyNode.Value, fields); s != "" {
+				msg += fmt.Sprintf(", did you mean %q?", s)
+			}
+			v.problems = append(v.problems, Problem{File: v.file, Line: keyNode.Line, Column: keyNode.Column, Key: key, Message: msg})
+			continue
+		}
+
+		v.nodes[key] = valueNode
+		if v.files != nil {
+			v.files[key] = v.file
+		}
+		v.walk(valueNode, ft, key)
+	}
+}
+
+// checkValues validates setting values of a decoded configuration
+func (v *validator) checkValues(cfg *Config) {
+	s := cfg.Server
+
+	if s.Port != "" {
+		if err := ValidatePortSpec(s.Port); err != nil {
+			v.add("server.port", "%v", err)
+		}
+	}
+	for _, proxy := range s.TrustedProxies {
+		if _, err := ParseProxy(proxy); err != nil {
+			v.add("server.trusted_proxies", "%v", err)
+		}
+	}
+	if s.Mode != "" && !contains(validModes, s.Mode) {
+		v.add("server.mode", "unknown mode %q (expected production or development)", s.Mode)
+	}
+	if _, err := strconv.ParseUint(s.SocketMode, 8, 32); s.SocketMode != "" && err != nil {
+		v.add("server.socket_mode", "invalid octal permissions %q", s.SocketMode)
+	}
+	if !contains(validAccessFormats, s.Logging.AccessFormat) {
+		v.add("server.logging.access_format", "unknown format %q (expected %s)", s.Logging.AccessFormat, strings.Join(validAccessFormats, ", "))
+	}
+	if !contains(validLogLevels, s.Logging.Level) {
+		v.add("server.logging.level", "unknown level %q (expected %s)", s.Logging.Level, strings.Join(validLogLevels, ", "))
+	}
+	if s.Logging.Audit.MaxSize < 0 {
+		v.add("server.logging.audit.max_size", "must not be negative")
+	}
+	if s.Logging.Audit.MaxFiles < 0 {
+		v.add("server.logging.audit.max_files", "must not be negative")
+	}
+	v.checkSecret("server.admin.password", s.Admin.Password, "server.admin.password_file", s.Admin.PasswordFile)
+	v.checkSecret("server.admin.api_token", s.Admin.APIToken, "server.admin.api_token_file", s.Admin.APITokenFile)
+	lockout := s.Admin.Lockout
+	for _, f := range []struct {
+		key   string
+		value int
+	}{
+		{"server.admin.lockout.max_failures", lockout.MaxFailures},
+		{"server.admin.lockout.window", lockout.Window},
+		{"server.admin.lockout.duration", lockout.Duration},
+		{"server.admin.lockout.base_delay", lockout.BaseDelay},
+		{"server.admin.lockout.max_delay", lockout.MaxDelay},
+	} {
+		if f.value < 0 {
+			v.add(f.key, "must not be negative")
+		}
+	}
+	if a := s.Admin.Argon2; a.Parallelism < 1 || a.Parallelism > 255 {
+		v.add("server.admin.argon2.parallelism", "must be between 1 and 255")
+	} else if a.Memory < 8*a.Parallelism {
+		v.add("server.admin.argon2.memory", "must be at least %d KiB for parallelism %d", 8*a.Parallelism, a.Parallelism)
+	}
+	if s.Admin.Argon2.Iterations < 1 {
+		v.add("server.admin.argon2.iterations", "must be at least 1")
+	}
+	if s.Session.Timeout < 0 {
+		v.add("server.session.timeout", "must not be negative")
+	}
+	if !contains(validSessionStores, s.Session.Store) {
+		v.add("server.session.store", "unknown store %q (expected %s)", s.Session.Store, strings.Join(validSessionStores, ", "))
+	}
+	if le := s.SSL.LetsEncrypt; le.Enabled {
+		if !contains(validChallenges, le.Challenge) {
+			v.add("server.ssl.letsencrypt.challenge", "unknown challenge %q (expected %s)", le.Challenge, strings.Join(validChallenges, ", "))
+		}
+		if le.Email == "" {
+			v.add("server.ssl.letsencrypt.email", "required when letsencrypt is enabled")
+		}
+	}
+	if s.Watch.Interval < 0 {
+		v.add("server.watch.interval", "must not be negative")
+	}
+	if s.HTTP.MaxHeaderBytes < 0 {
+		v.add("server.http.max_header_bytes", "must not be negative")
+	}
+
+	if s.Metrics.Endpoint != "" && !strings.HasPrefix(s.Metrics.Endpoint, "/") {
+		v.add("server.metrics.endpoint", "must be a path starting with /")
+	}
+
+	if !contains(validThemes, cfg.WebUI.Theme) {
+		v.add("web-ui.theme", "unknown theme %q (expected %s)", cfg.WebUI.Theme, strings.Join(validThemes, ", "))
+	}
+	for _, f := range []struct{ key, value string }{
+		{"web-ui.logo", cfg.WebUI.Logo},
+		{"web-ui.favicon", cfg.WebUI.Favicon},
+	} {
+		if err := validateAssetURL(f.value); err != nil {
+			v.add(f.key, "%v", err)
+		}
+	}
+	for i, a := range cfg.WebUI.Notifications.Announcements {
+		if strings.TrimSpace(a) == "" || strings.ContainsAny(a, "\r\n") {
+			v.add("web-ui.notifications.announcements", "entry %d must be a single non-empty line", i+1)
+		}
+	}
+	for _, f := range []struct {
+		key   string
+		paths []string
+	}{
+		{"web-robots.allow", cfg.WebRobots.Allow},
+		{"web-robots.deny", cfg.WebRobots.Deny},
+	} {
+		for _, p := range f.paths {
+			if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, " \t\r\n") {
+				v.add(f.key, "%q must be a path starting with / without spaces", p)
+			}
+		}
+	}
+	if c := cfg.WebSecurity.Admin; c != "" {
+		if addr, err := mail.ParseAddress(c); err != nil || addr.Address != c {
+			v.add("web-security.admin", "%q is not an email address", c)
+		}
+	}
+	if err := ValidateCORS(cfg.WebSecurity.CORS); err != nil {
+		v.add("web-security.cors", "%v", err)
+	}
+}
+
+// validateAssetURL accepts an empty value, a path on this server or an
+// http(s) URL
+func validateAssetURL(s string) error {
+	if s == "" || (strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//")) {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be a path starting with / or an http(s) URL", s)
+	}
+	return nil
+}
+
+// checkSecret checks that a secret file or env: reference can be resolved
+func (v *validator) checkSecret(key, value, fileKey, file string) {
+	if file != "" {
+		if value != "" {
+			v.add(fileKey, "cannot be combined with %s", key)
+		} else if _, err := readSecretFile(file); err != nil {
+			v.add(fileKey, "%v", err)
+		}
+		return
+	}
+	if name, ok := strings.CutPrefix(value, EnvRefPrefix); ok {
+		if _, set := os.LookupEnv(name); !set {
+			v.add(key, "environment variable %s is not set", name)
+		}
+	}
+}
+
+// ValidMode reports whether mode is a valid server.mode
+func ValidMode(mode string) bool {
+	return contains(validModes, mode)
+}
+
+// ParseProxy parses a server.trusted_proxies entry, an IP address or CIDR
+func ParseProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ValidatePortSpec checks a "PORT" or "HTTP_PORT,HTTPS_PORT" specification
+func ValidatePortSpec(spec string) error {
+	parts := strings.Split(spec, ",")
+	if len(parts) > 2 {
+		return fmt.Errorf("expected PORT or HTTP_PORT,HTTPS_PORT, got %q", spec)
+	}
+	for _, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", strings.TrimSpace(p))
+		}
+	}
+	if len(parts) == 2 && strings.TrimSpace(parts[0]) == strings.TrimSpace(parts[1]) {
+		return fmt.Errorf("HTTP and HTTPS ports must differ")
+	}
+	return nil
+}
+
+// ValidateCORS checks a CORS setting: empty, "*" or a comma-separated list
+// of origins such as "https://example.com"
+func ValidateCORS(cors string) error {
+	if cors == "" || cors == "*" {
+		return nil
+	}
+	for _, origin := range strings.Split(cors, ",") {
+		origin = strings.TrimSpace(origin)
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid origin %q (expected scheme://host[:port])", origin)
+		}
+		if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid origin %q (origins have no path)", origin)
+		}
+	}
+	return nil
+}
+
+// closestKey suggests the known key nearest to an unknown one
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), name); d < bestDist || (d == bestDist && best != "" && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"crypto/sha256"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// Watcher polls the configuration files and reloads when they change.
+// A change is only acted on once the files have been stable for one
+// interval, so editors writing in several steps trigger a single reload.
+type Watcher struct {
+	interval time.Duration
+	notify   func(changes []Change, err error)
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// Files returns the files the current configuration was read from and the
+// conf.d directory
+func Files() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]string(nil), files...)
+}
+
+// Watch starts polling the configuration files every interval. notify, if
+// not nil, is called with the outcome of every reload the watcher starts.
+func Watch(interval time.Duration, notify func(changes []Change, err error)) *Watcher {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	w := &Watcher{
+		interval: interval,
+		notify:   notify,
+		stop:     make(chan struct{}),
+	}
+	go w.run()
+	log.Printf("Config: watching %v for changes (every %s)", Files(), interval)
+	return w
+}
+
+// Stop stops the watcher
+func (w *Watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// run compares file fingerprints on every tick
+func (w *Watcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	applied := fingerprint(Files())
+	pending := ""
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := fingerprint(Files())
+		switch {
+		case current == applied:
+			pending = ""
+		case current != pending:
+			// Changed since the last tick; wait until it settles
+			pending = current
+		default:
+			applied, pending = current, ""
+			w.reload()
+			// Pick up anything written by the reload itself
+			applied = fingerprint(Files())
+		}
+	}
+}
+
+// reload runs the validated reload, keeping the running configuration
+// when the edited file is rejected
+func (w *Watcher) reload() {
+	log.Println("Config: file changed, reloading...")
+	changes, err := Reload()
+	if w.notify != nil {
+		w.notify(changes, err)
+	}
+	if err != nil {
+		logging.Warnf("Config: rejected edit, keeping current configuration: %v", err)
+		return
+	}
+	log.Printf("Config: reloaded, %d change(s)", len(changes))
+}
+
+// fingerprint hashes the contents of files and the entries of
+// directories; missing paths hash as empty
+func fingerprint(paths []string) string {
+	h := sha256.New()
+	for _, p := range paths {
+		h.Write([]byte(p))
+		if entries, err := os.ReadDir(p); err == nil {
+			for _, e := range entries {
+				h.Write([]byte(e.Name()))
+			}
+		} else if data, err := os.ReadFile(p); err == nil {
+			h.Write(data)
+		}
+		h.Write([]byte{0})
+	}
+	return string(h.Sum(nil))
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileMode is used for the config file and its backup; they hold the admin
+// password and API token
+const fileMode = 0600
+
+// fileHeader is written at the top of newly created config files
+const fileHeader = `GitMessages Server Configuration
+Documentation: https://gitmessages.apimgr.us/docs`
+
+// keyComments documents keys in newly created config files, by key path
+var keyComments = map[string]string{
+	"server.address":                       `Use "unix:/run/gitmessages.sock" to listen on a unix socket`,
+	"server.trusted_proxies":               "IPs or CIDRs of reverse proxies whose X-Forwarded-For and X-Real-IP\nheaders give the client IP; other clients are identified by their address",
+	"server.mode":                          "production or development",
+	"server.update_branch":                 "stable, beta or daily",
+	"server.admin.password":                `Plain text, an argon2id hash or "env:VARIABLE"; password_file reads it from a file`,
+	"server.admin.lockout":                 "Failed logins double the wait from base_delay to max_delay (seconds);\nmax_failures within window locks the client IP out for duration",
+	"server.admin.argon2":                  "Cost of new password hashes (memory in KiB); plain text and older hashes\nin this file are rehashed at the next admin login",
+	"server.logging.audit":                 "Rotate audit.log past max_size MiB, keeping max_files old files (0 = never rotate)",
+	"server.session.timeout":               "Admin session lifetime in seconds",
+	"server.session.store":                 "file keeps admin sessions across restarts, memory does not",
+	"server.session.bind_ip":               "Reject a session cookie used from another IP or browser",
+	"server.ssl":                           `Port "80,443" serves HTTP and HTTPS; a single port 443 is HTTPS-only`,
+	"server.ssl.hsts.preload":              "Asks browsers to pin the domain to HTTPS for good; only enable when submitting it to hstspreload.org",
+	"server.ssl.letsencrypt.directory_url": "Empty uses Let's Encrypt production; ca_bundle trusts a private ACME CA",
+	"server.watch":                         "Reload automatically when config files or conf.d change; interval in seconds",
+	"server.http": "Timeouts in seconds; h2c serves HTTP/2 without TLS for reverse proxies.\n" +
+		"max_requests_per_conn closes keep-alive connections after N requests (0 = unlimited)",
+}
+
+// saveConfig writes cfg to path. Values of an existing file are updated in
+// place so comments, key order and unknown keys survive the rewrite.
+func saveConfig(cfg *Config, path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := renderConfig(cfg, path)
+	if err != nil {
+		return err
+	}
+	return writeConfig(path, data)
+}
+
+// writeConfig atomically replaces the config file at path with data,
+// keeping the previous version as path.bak
+func writeConfig(path string, data []byte) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if existing != nil {
+		if bytes.Equal(existing, data) {
+			return os.Chmod(path, fileMode)
+		}
+		if err := os.WriteFile(path+".bak", existing, fileMode); err != nil {
+			return fmt.Errorf("failed to back up config file: %w", err)
+		}
+	}
+	return writeFileAtomic(path, data, fileMode)
+}
+
+// renderConfig returns the file saveConfig would write for cfg
+func renderConfig(cfg *Config, path string) ([]byte, error) {
+	var fresh yaml.Node
+	if err := fresh.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&fresh}}
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		old, err := parseDocument(path, existing)
+		if err != nil {
+			return nil, fmt.Errorf("refusing to overwrite unparseable config file: %w", err)
+		}
+		if old.Content[0].Kind == yaml.MappingNode {
+			mergeNode(old.Content[0], &fresh)
+			doc = old
+		}
+	case os.IsNotExist(err):
+		doc.HeadComment = fileHeader
+		addComments(&fresh, "")
+	default:
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	data, err := encodeDocument(path, doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return data, nil
+}
+
+// mergeNode updates dst with the values of src. Keys only present in dst
+// are kept; keys only present in src are appended.
+func mergeNode(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		existing := mappingValue(dst, key.Value)
+		if existing == nil {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+
+		switch {
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeNode(existing, value)
+		case sameValue(existing, value):
+			// Leave the user's formatting alone
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			existing.Content = value.Content
+		default:
+			existing.Kind = value.Kind
+			existing.Tag = value.Tag
+			existing.Value = value.Value
+			existing.Style = value.Style
+			existing.Content = value.Content
+		}
+	}
+}
+
+// mappingValue returns the value for key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// sameValue reports whether two nodes hold the same data
+func sameValue(a, b *yaml.Node) bool {
+	var va, vb interface{}
+	if a.Decode(&va) != nil || b.Decode(&vb) != nil {
+		return false
+	}
+	return fmt.Sprint(va) == fmt.Sprint(vb) && a.Kind == b.Kind
+}
+
+// addComments attaches keyComments to a freshly encoded mapping node
+func addComments(node *yaml.Node, prefix string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if c, ok := keyComments[path]; ok {
+			key.HeadComment = c
+		}
+		addComments(node.Content[i+1], path)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+// so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return fmt.Errorf("failed to set config file permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+	return nil
+}
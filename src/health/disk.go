@@ -0,0 +1,30 @@
+package health
+
+import (
+	"context"
+	"fmt"
+)
+
+// Disk space thresholds for DiskSpace
+const (
+	diskWarnPercent = 10
+	diskFailBytes   = 50 << 20
+)
+
+// DiskSpace returns a check that warns when the filesystem holding path
+// has less than 10% free and fails below 50 MB
+func DiskSpace(path string) CheckFunc {
+	return func(ctx context.Context) error {
+		free, total, err := diskUsage(path)
+		if err != nil {
+			return fmt.Errorf("failed to read disk usage of %s: %w", path, err)
+		}
+		if free < diskFailBytes {
+			return fmt.Errorf("only %d MB free on %s", free>>20, path)
+		}
+		if total > 0 && free*100/total < diskWarnPercent {
+			return Warn("%d%% free on %s (%d MB)", free*100/total, path, free>>20)
+		}
+		return nil
+	}
+}
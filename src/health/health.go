@@ -0,0 +1,181 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds how long a single check may run
+const checkTimeout = 5 * time.Second
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// Overall statuses
+const (
+	Healthy   = "healthy"
+	Degraded  = "degraded"
+	Unhealthy = "unhealthy"
+)
+
+// CheckFunc runs a health check. Returning a warning (see Warn) reports a
+// degraded but still ready service; any other error fails the check.
+type CheckFunc func(ctx context.Context) error
+
+// warning marks a non-fatal check result
+type warning struct {
+	msg string
+}
+
+func (w *warning) Error() string {
+	return w.msg
+}
+
+// Warn returns an error that reports a check as degraded rather than failed
+func Warn(format string, args ...interface{}) error {
+	return &warning{msg: fmt.Sprintf(format, args...)}
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Message   string  `json:"message,omitempty"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Report is the outcome of running all checks
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every critical check passed or only warned
+func (r Report) Ready() bool {
+	return r.Status != Unhealthy
+}
+
+// Failed returns the checks that did not pass
+func (r Report) Failed() []Result {
+	var failed []Result
+	for _, c := range r.Checks {
+		if c.Status != StatusOK {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// Public returns the report without check messages, which can name file
+// paths and configuration errors
+func (r Report) Public() Report {
+	public := Report{Status: r.Status, Checks: make([]Result, len(r.Checks))}
+	for i, c := range r.Checks {
+		c.Message = ""
+		public.Checks[i] = c
+	}
+	return public
+}
+
+// check is a registered check
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Registry holds the registered health checks
+type Registry struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+// New creates an empty registry
+func New() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check. A failing critical check makes the service
+// unhealthy and not ready; a failing non-critical check only degrades it.
+func (r *Registry) Register(name string, critical bool, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// Run executes all checks concurrently and returns the combined report
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	status := Healthy
+	for _, res := range results {
+		switch {
+		case res.Status == StatusFail && res.Critical:
+			status = Unhealthy
+		case res.Status != StatusOK && status == Healthy:
+			status = Degraded
+		}
+	}
+	return Report{Status: status, Checks: results}
+}
+
+// runCheck runs a single check with a timeout
+func runCheck(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", checkTimeout)
+	}
+
+	res := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		Critical:  c.critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Message = err.Error()
+		res.Status = StatusFail
+		var w *warning
+		if errors.As(err, &w) {
+			res.Status = StatusWarn
+		}
+	}
+	return res
+}
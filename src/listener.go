@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/gitmessages/src/config"
+)
+
+// systemd passes activated sockets starting at this file descriptor
+const listenFDsStart = 3
+
+// unixSocketPath returns the socket path for a "unix:/path" address
+func unixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, "unix:") {
+		return "", false
+	}
+	return strings.TrimPrefix(address, "unix:"), true
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation
+// (LISTEN_FDS), in the order of the ListenStream= lines of the socket unit
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	// Do not pass the sockets on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a unix socket, replacing a stale socket file and
+// applying the configured permissions
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return l, nil
+}
+
+// parseSocketMode parses an octal permission string such as "0660"
+func parseSocketMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0660, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %q", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// openListener creates the listener for a server address
+func openListener(addr string, socketMode os.FileMode) (net.Listener, error) {
+	if path, ok := unixSocketPath(addr); ok {
+		return listenUnix(path, socketMode)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// socketListenStreams returns the ListenStream= values for a systemd socket
+// unit matching the server configuration, HTTP before HTTPS
+func socketListenStreams(server config.ServerConfig) []string {
+	if path, ok := unixSocketPath(server.Address); ok {
+		return []string{path}
+	}
+
+	port := server.Port
+	if port == "" {
+		port = "8080"
+	}
+	httpPort, httpsPort, err := parsePorts(port, server.SSL.Enabled)
+	if err != nil {
+		return nil
+	}
+
+	var streams []string
+	for _, p := range []string{httpPort, httpsPort} {
+		if p == "" {
+			continue
+		}
+		if server.Address == "" || server.Address == "0.0.0.0" || server.Address == "::" {
+			streams = append(streams, p)
+		} else {
+			streams = append(streams, net.JoinHostPort(server.Address, p))
+		}
+	}
+	return streams
+}
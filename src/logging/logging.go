@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// Logging levels, lowest first
+const (
+	LevelDebug int32 = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levels maps server.logging.level values to levels
+var levels = map[string]int32{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+// Level tags start the message of every line logged through Debugf, Warnf,
+// Errorf and Fatalf. Lines logged with the log package directly are info.
+var tags = []struct {
+	tag   []byte
+	level int32
+}{
+	{[]byte("[DEBUG] "), LevelDebug},
+	{[]byte("[WARN] "), LevelWarn},
+	{[]byte("[ERROR] "), LevelError},
+}
+
+// Debugf logs at debug level
+func Debugf(format string, args ...interface{}) {
+	log.Output(2, "[DEBUG] "+fmt.Sprintf(format, args...))
+}
+
+// Warnf logs at warn level
+func Warnf(format string, args ...interface{}) {
+	log.Output(2, "[WARN] "+fmt.Sprintf(format, args...))
+}
+
+// Errorf logs at error level
+func Errorf(format string, args ...interface{}) {
+	log.Output(2, "[ERROR] "+fmt.Sprintf(format, args...))
+}
+
+// Fatalf logs at error level and exits
+func Fatalf(format string, args ...interface{}) {
+	log.Output(2, "[ERROR] "+fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Writer drops log lines below the configured level
+type Writer struct {
+	out   io.Writer
+	level atomic.Int32
+}
+
+// NewWriter creates a Writer logging at info level
+func NewWriter(out io.Writer) *Writer {
+	w := &Writer{out: out}
+	w.level.Store(LevelInfo)
+	return w
+}
+
+// SetLevel changes the level; unknown names select info
+func (w *Writer) SetLevel(name string) {
+	level, ok := levels[name]
+	if !ok {
+		level = LevelInfo
+	}
+	w.level.Store(level)
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if lineLevel(p) < w.level.Load() {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// lineLevel reads the level tag at the start of the message, after the
+// "prefix: file.go:123: " header written by the log package
+func lineLevel(line []byte) int32 {
+	msg := line
+	if i := bytes.Index(msg, []byte(".go:")); i >= 0 {
+		if j := bytes.Index(msg[i:], []byte(": ")); j >= 0 {
+			msg = msg[i+j+2:]
+		}
+	}
+	for _, t := range tags {
+		if bytes.HasPrefix(msg, t.tag) {
+			return t.level
+		}
+	}
+	return LevelInfo
+}
@@ -1,23 +1,42 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/apimgr/gitmessages/src/admin"
+	"github.com/apimgr/gitmessages/src/audit"
 	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/health"
+	"github.com/apimgr/gitmessages/src/logging"
 	"github.com/apimgr/gitmessages/src/messages"
+	"github.com/apimgr/gitmessages/src/metrics"
+	"github.com/apimgr/gitmessages/src/middleware"
+	"github.com/apimgr/gitmessages/src/mode"
 	"github.com/apimgr/gitmessages/src/paths"
+	"github.com/apimgr/gitmessages/src/scheduler"
+	svc "github.com/apimgr/gitmessages/src/service"
+	"github.com/apimgr/gitmessages/src/ssl"
+	"golang.org/x/term"
 )
 
 // Version information (set by build flags)
@@ -31,10 +50,27 @@ const projectName = "gitmessages"
 
 var msgManager *messages.Manager
 var cfg *config.Config
+var healthChecks = health.New()
+var logOutput = logging.NewWriter(os.Stderr)
+var auditLog *audit.Log
+var adminHandler *admin.Handler
+
+// stringList collects a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
 
 func init() {
 	log.SetPrefix("gitmessages: ")
 	log.SetFlags(log.Lshortfile)
+	log.SetOutput(logOutput)
 }
 
 func main() {
@@ -48,6 +84,9 @@ func main() {
 	showVersion := flag.Bool("version", false, "Show version information")
 	showStatus := flag.Bool("status", false, "Check server status (for health checks)")
 	showHelp := flag.Bool("help", false, "Show help")
+	strict := flag.Bool("strict", false, "Refuse to start with an invalid configuration")
+	var sets stringList
+	flag.Var(&sets, "set", "Override a config key: key=value (repeatable)")
 
 	// Mode and update flags
 	modeFlag := flag.String("mode", "", "Application mode: production, development")
@@ -57,7 +96,7 @@ func main() {
 	serviceCmd := flag.String("service", "", "Service commands: start, stop, restart, reload, status, --install, --uninstall, --disable")
 
 	// Maintenance commands
-	maintenanceCmd := flag.String("maintenance", "", "Maintenance commands: backup, restore, update, mode, setup")
+	maintenanceCmd := flag.String("maintenance", "", "Maintenance commands: backup, restore, update, mode, setup, config-check, config-show, hash-password, token, admin-2fa")
 
 	flag.Parse()
 
@@ -86,7 +125,13 @@ func main() {
 
 	// Ensure directories exist
 	if err := paths.EnsureDirectories(dirs); err != nil {
-		log.Printf("Warning: Failed to create directories: %v", err)
+		logging.Warnf("Failed to create directories: %v", err)
+	}
+
+	// GITMESSAGES_* variables and --set flags override the config file
+	if err := config.SetOverrides(os.Environ(), sets); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
 	// Load configuration
@@ -94,21 +139,39 @@ func main() {
 	var err error
 	cfg, err = config.Load(configPath)
 	if err != nil {
-		log.Printf("Warning: Failed to load config: %v, using defaults", err)
+		logging.Warnf("Failed to load config: %v, using defaults", err)
 		cfg = config.DefaultConfig()
 	}
 
 	// Handle --status (health check)
 	if *showStatus {
 		checkPort := cfg.Server.Port
+		if *port != "" {
+			checkPort = *port
+		} else if envPort := os.Getenv("PORT"); envPort != "" {
+			checkPort = envPort
+		}
 		if checkPort == "" {
 			checkPort = "8080"
 		}
-		if err := checkHealth(checkPort); err != nil {
+		var report health.Report
+		httpPort, httpsPort, err := parsePorts(checkPort, cfg.Server.SSL.Enabled)
+		if err == nil {
+			report, err = checkHealth(cfg.Server.Address, httpPort, httpsPort)
+		}
+		// Messages are only served to status:read tokens, via /healthz?verbose=1
+		for _, c := range report.Failed() {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", c.Name, c.Status)
+		}
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("OK")
+		if report.Status == health.Degraded {
+			fmt.Println("OK (degraded)")
+		} else {
+			fmt.Println("OK")
+		}
 		os.Exit(0)
 	}
 
@@ -141,6 +204,16 @@ func main() {
 		return
 	}
 
+	// Validate configuration; strict mode refuses to start on any problem
+	problems, err := config.ValidateFile(configPath)
+	if err == nil && len(problems) > 0 {
+		verr := &config.ValidationError{Path: configPath, Problems: problems}
+		if *strict {
+			logging.Fatalf("Invalid configuration (strict mode):\n%v", verr)
+		}
+		logging.Warnf("%v", verr)
+	}
+
 	// Determine port (flag > env > config > default)
 	serverPort := cfg.Server.Port
 	if *port != "" {
@@ -163,23 +236,63 @@ func main() {
 		serverAddress = "0.0.0.0"
 	}
 
-	// Build listen address
-	listen := fmt.Sprintf("%s:%s", serverAddress, serverPort)
-	if serverAddress == "0.0.0.0" || serverAddress == "::" {
-		listen = ":" + serverPort
+	// Split into HTTP and HTTPS ports
+	httpPort, httpsPort, err := parsePorts(serverPort, cfg.Server.SSL.Enabled)
+	if err != nil {
+		logging.Fatalf("Invalid port configuration %q: %v", serverPort, err)
+	}
+
+	// Unix sockets carry plain HTTP; TLS terminates at the reverse proxy
+	if _, ok := unixSocketPath(serverAddress); ok && httpsPort != "" {
+		logging.Warnf("HTTPS is not served on unix sockets, ignoring port %s", httpsPort)
+		if httpPort == "" {
+			httpPort = httpsPort
+		}
+		httpsPort = ""
+	}
+	socketMode, err := parseSocketMode(cfg.Server.SocketMode)
+	if err != nil {
+		logging.Fatalf("Invalid socket_mode: %v", err)
+	}
+
+	logOutput.SetLevel(cfg.Server.Logging.Level)
+
+	// Determine mode (env > config > default)
+	mode.Initialize("")
+	if os.Getenv("MODE") == "" && cfg.Server.Mode != "" {
+		mode.Set(mode.ParseMode(cfg.Server.Mode))
 	}
 
 	// Log startup information
 	log.Printf("gitmessages %s (commit: %s, built: %s)", Version, Commit, BuildDate)
+	log.Printf("Mode: %s", mode.Get())
 
 	// Load messages
 	log.Println("Loading git commit messages...")
 	msgManager, err = messages.New()
 	if err != nil {
-		log.Fatalf("Failed to load messages: %v", err)
+		logging.Fatalf("Failed to load messages: %v", err)
 	}
 	log.Printf("Loaded %d messages", msgManager.Count())
 
+	// Setup scheduler for periodic tasks
+	sched := scheduler.New()
+
+	// Register health checks
+	healthChecks.Register("dataset", true, func(ctx context.Context) error {
+		if msgManager.Count() == 0 {
+			return fmt.Errorf("no messages loaded")
+		}
+		return nil
+	})
+	healthChecks.Register("config", false, func(ctx context.Context) error {
+		return config.Verify()
+	})
+	healthChecks.Register("disk", true, health.DiskSpace(dirs.Data))
+	healthChecks.Register("scheduler", false, func(ctx context.Context) error {
+		return sched.Alive()
+	})
+
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
@@ -193,24 +306,104 @@ func main() {
 	if cfg.Server.Session.Timeout > 0 {
 		sessionTimeout = cfg.Server.Session.Timeout
 	}
-	adminHandler := admin.NewHandler(
+	adminHandler = admin.NewHandler(
 		cfg.Server.Admin.Username,
 		cfg.Server.Admin.Password,
 		cfg.Server.Admin.APIToken,
 		sessionTimeout,
-		false, // SSL enabled
+		httpsPort != "",
+		dirs.Data,
 		Version,
 		Commit,
 		BuildDate,
 	)
+	if err := admin.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logging.Warnf("%v, forwarding headers will be ignored", err)
+	}
+	adminHandler.SetLockoutPolicy(cfg.Server.Admin.Lockout)
+	adminHandler.SetSessionPolicy(cfg.Server.Session)
+	adminHandler.SetPasswordHashing(cfg.Server.Admin.Argon2, storeAdminPasswordHash)
+	if cfg.Server.Session.Store == "file" {
+		if store, err := admin.NewFileSessionStore(dirs.Data); err != nil {
+			logging.Warnf("%v, admin sessions will not survive a restart", err)
+		} else {
+			adminHandler.SetSessionStore(store)
+		}
+	}
+	if auditLog, err = audit.Open(dirs.Logs); err != nil {
+		logging.Warnf("%v, admin actions will not be audited", err)
+	}
+	auditLog.SetRotation(int64(cfg.Server.Logging.Audit.MaxSize)<<20, cfg.Server.Logging.Audit.MaxFiles)
+	adminHandler.SetAuditLog(auditLog)
+	adminHandler.SetRestartCheck(needsRestart)
 	adminHandler.RegisterRoutes(mux)
+	mux.HandleFunc("/api/v1/reset", adminHandler.RequireToken(admin.ScopeDataWrite, handleReset))
+
+	// Setup access log
+	accessLogger, err := openAccessLog(dirs.Logs)
+	if err != nil {
+		logging.Warnf("Failed to open access log: %v, logging to stdout", err)
+		accessLogger = log.New(os.Stdout, "", 0)
+	}
+
+	wrap := func(h http.Handler) http.Handler {
+		h = middleware.Recover(h)
+		h = middleware.AccessLog(accessLogger, accessLogFormat)(h)
+		return middleware.RequestID(h)
+	}
+	requestStats := middleware.NewStats()
+	metricsEndpoint := &metricsRoute{}
+	handler := wrap(corsMiddleware(requestStats.Middleware(metricsEndpoint.Middleware(mux))))
+	adminHandler.AddStatusProvider("requests", func() interface{} {
+		return requestStats.Snapshot()
+	})
+	adminHandler.AddStatusProvider("messages", messageStatus)
+	adminHandler.SetHealthCheck(healthChecks.Run)
+
+	// Setup TLS
+	var sslManager *ssl.Manager
+	var tlsConfig *tls.Config
+	if httpsPort != "" {
+		sslManager = ssl.NewManager(newSSLConfig(cfg.Server.SSL, dirs.Data))
+		tlsConfig, err = sslManager.GetTLSConfig(sslDomains(cfg.Server.FQDN))
+		if err != nil {
+			logging.Fatalf("Failed to configure TLS: %v", err)
+		}
+
+		adminHandler.AddStatusProvider("certificates", func() interface{} {
+			return sslManager.Certificates()
+		})
+		sched.AddTask("ssl-certificate-check", 6*time.Hour, sslManager.CheckCertificates)
+		healthChecks.Register("certificates", true, func(ctx context.Context) error {
+			return certificateHealth(sslManager.Certificates())
+		})
+		go sslManager.CheckCertificates()
+	}
 
-	server := &http.Server{
-		Addr:         listen,
-		Handler:      corsMiddleware(mux),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// Prometheus metrics; scraping needs a token with status:read
+	metricsEndpoint.Set(cfg.Server.Metrics, sslManager)
+
+	// Setup HTTP and HTTPS servers
+	var servers []*http.Server
+	httpConfig := cfg.Server.HTTP
+	limiter := &keepAliveLimiter{}
+	if httpPort != "" {
+		httpHandler := handler
+		if httpsPort != "" && cfg.Server.SSL.RedirectHTTP {
+			httpHandler = wrap(middleware.RedirectHTTPS(httpsPort))
+		}
+		if sslManager != nil {
+			// Serve ACME http-01 challenges before anything else
+			httpHandler = sslManager.GetHTTPHandler(httpHandler)
+		}
+		servers = append(servers, newServer(listenAddr(serverAddress, httpPort), httpHandler, nil, httpConfig, limiter))
+	}
+	if httpsPort != "" {
+		httpsHandler := handler
+		if hsts := cfg.Server.SSL.HSTS; hsts.Enabled {
+			httpsHandler = middleware.HSTS(hsts.MaxAge, hsts.IncludeSubdomains, hsts.Preload)(handler)
+		}
+		servers = append(servers, newServer(listenAddr(serverAddress, httpsPort), httpsHandler, tlsConfig, httpConfig, limiter))
 	}
 
 	// Log endpoints
@@ -221,37 +414,124 @@ func main() {
 	log.Printf("  GET /api/v1/random.txt       - Random message (text)")
 	log.Printf("  GET /api/v1/messages         - All messages (JSON)")
 	log.Printf("  GET /api/v1/stats            - Statistics")
-	log.Printf("  POST /api/v1/reset           - Reset cycle")
+	log.Printf("  POST /api/v1/reset           - Reset cycle (token with data:write)")
+	if endpoint := metricsEndpoint.Endpoint(); endpoint != "" {
+		log.Printf("  GET %-24s - Prometheus metrics (token with status:read)", endpoint)
+	}
 	log.Printf("")
 	log.Printf("Special Files:")
 	log.Printf("  GET /robots.txt              - Robots file")
 	log.Printf("  GET /security.txt            - Security contact")
 	log.Printf("  GET /manifest.json           - PWA manifest")
 	log.Printf("")
-	log.Printf("Listening on %s", listen)
+	// Watch the config file for containers where signals are awkward
+	var watcher *config.Watcher
+	if cfg.Server.Watch.Enabled {
+		watcher = config.Watch(time.Duration(cfg.Server.Watch.Interval)*time.Second, auditWatcherReload)
+	}
 
-	// Start server in goroutine
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- server.ListenAndServe()
-	}()
+	// Apply reloaded settings to the running server
+	config.Subscribe(func(old, newCfg *config.Config, changes []config.Change) {
+		timeout := 3600
+		if newCfg.Server.Session.Timeout > 0 {
+			timeout = newCfg.Server.Session.Timeout
+		}
+		adminHandler.UpdateConfig(newCfg.Server.Admin.Username, newCfg.Server.Admin.Password, newCfg.Server.Admin.APIToken, timeout)
+		if err := admin.SetTrustedProxies(newCfg.Server.TrustedProxies); err != nil {
+			logging.Warnf("%v, keeping the previous trusted proxies", err)
+		}
+		adminHandler.SetLockoutPolicy(newCfg.Server.Admin.Lockout)
+		adminHandler.SetSessionPolicy(newCfg.Server.Session)
+		adminHandler.SetPasswordHashing(newCfg.Server.Admin.Argon2, storeAdminPasswordHash)
+		logOutput.SetLevel(newCfg.Server.Logging.Level)
+		if newCfg.Server.Metrics != old.Server.Metrics {
+			metricsEndpoint.Set(newCfg.Server.Metrics, sslManager)
+			if endpoint := metricsEndpoint.Endpoint(); endpoint != "" {
+				log.Printf("Serving Prometheus metrics at %s", endpoint)
+			} else {
+				log.Printf("Prometheus metrics disabled")
+			}
+		}
+		auditLog.SetRotation(int64(newCfg.Server.Logging.Audit.MaxSize)<<20, newCfg.Server.Logging.Audit.MaxFiles)
+		if os.Getenv("MODE") == "" && newCfg.Server.Mode != "" {
+			mode.Set(mode.ParseMode(newCfg.Server.Mode))
+		}
+		// Compare against the settings the servers were started with
+		applyHTTPConfig(servers, httpConfig, newCfg.Server.HTTP, limiter)
+
+		if newCfg.Server.Watch != old.Server.Watch {
+			if watcher != nil {
+				watcher.Stop()
+				watcher = nil
+			}
+			if newCfg.Server.Watch.Enabled {
+				watcher = config.Watch(time.Duration(newCfg.Server.Watch.Interval)*time.Second, auditWatcherReload)
+			}
+		}
+
+		for _, c := range changes {
+			if needsRestart(c.Key) {
+				logging.Warnf("change to %s takes effect after a restart", c.Key)
+			}
+		}
+	})
+
+	// Sockets passed by systemd socket activation replace our own listeners
+	activated, err := systemdListeners()
+	if err != nil {
+		logging.Fatalf("Socket activation failed: %v", err)
+	}
+
+	sched.Start()
+
+	// Start servers in goroutines
+	errChan := make(chan error, len(servers))
+	for i, server := range servers {
+		var l net.Listener
+		if i < len(activated) {
+			l = activated[i]
+		} else if l, err = openListener(server.Addr, socketMode); err != nil {
+			logging.Fatalf("Failed to listen on %s: %v", server.Addr, err)
+		}
+
+		scheme := "HTTP"
+		if server.TLSConfig != nil {
+			scheme = "HTTPS"
+		}
+		if i < len(activated) {
+			log.Printf("Listening on %s (%s, socket activated)", l.Addr(), scheme)
+		} else {
+			log.Printf("Listening on %s (%s)", server.Addr, scheme)
+		}
+		go serve(server, l, errChan)
+	}
 
 	// Wait for shutdown signal or server error
 	for {
 		select {
 		case err := <-errChan:
-			log.Fatal(err)
+			logging.Fatalf("%v", err)
 		case sig := <-sigChan:
 			switch sig {
 			case syscall.SIGHUP:
 				log.Println("Received SIGHUP, reloading configuration...")
-				if _, err := config.Load(configPath); err != nil {
-					log.Printf("Failed to reload config: %v", err)
+				changes, err := config.Reload()
+				auditReload(audit.ActorSignal, changes, err)
+				if err != nil {
+					logging.Errorf("Failed to reload config, keeping current configuration: %v", err)
 				} else {
-					log.Println("Configuration reloaded")
+					log.Printf("Configuration reloaded, %d change(s)", len(changes))
 				}
 			default:
 				log.Printf("Received signal %v, shutting down...", sig)
+				// Closing the listeners also removes unix socket files
+				for _, server := range servers {
+					server.Close()
+				}
+				if err := adminHandler.Close(); err != nil {
+					logging.Warnf("%v", err)
+				}
+				auditLog.Close()
 				os.Exit(0)
 			}
 		}
@@ -261,6 +541,8 @@ func main() {
 func setupRoutes(mux *http.ServeMux) {
 	// Health checks
 	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/healthz/live", handleLiveness)
+	mux.HandleFunc("/healthz/ready", handleReadiness)
 	mux.HandleFunc("/api/v1/healthz", handleHealthz)
 	mux.HandleFunc("/api/v1/healthz.txt", handleHealthzText)
 
@@ -279,7 +561,6 @@ func setupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/messages.txt", handleMessagesText)
 	mux.HandleFunc("/api/v1/stats", handleStats)
 	mux.HandleFunc("/api/v1/stats.txt", handleStatsText)
-	mux.HandleFunc("/api/v1/reset", handleReset)
 
 	// Home page
 	mux.HandleFunc("/", handleHome)
@@ -287,17 +568,20 @@ func setupRoutes(mux *http.ServeMux) {
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		corsOrigin := "*"
-		if cfg != nil && cfg.WebSecurity.CORS != "" {
-			corsOrigin = cfg.WebSecurity.CORS
+		corsOrigin := allowedOrigin(config.GetCORS(), r.Header.Get("Origin"))
+		if corsOrigin != "*" {
+			w.Header().Add("Vary", "Origin")
 		}
 
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
-		w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
+		if corsOrigin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -308,6 +592,17 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// writeJSONError writes the standard error envelope including the request ID
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error":      message,
+		"request_id": middleware.GetRequestID(r.Context()),
+	})
+}
+
 // Handlers
 
 func handleHome(w http.ResponseWriter, r *http.Request) {
@@ -332,17 +627,107 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 </html>`, Version)
 }
 
+// healthReport runs the health checks. Check messages can name file paths
+// and configuration errors, so only tokens with status:read see them.
+func healthReport(r *http.Request) health.Report {
+	report := healthChecks.Run(r.Context())
+	if adminHandler == nil || !adminHandler.TokenAllows(r, admin.ScopeStatusRead) {
+		report = report.Public()
+	}
+	return report
+}
+
+// handleHealthz runs the health checks; ?verbose=1 includes every check
 func handleHealthz(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "healthy",
+	report := healthReport(r)
+
+	resp := map[string]interface{}{
+		"status":  report.Status,
 		"version": Version,
-	})
+	}
+	if v := r.URL.Query().Get("verbose"); v == "1" || v == "true" {
+		resp["checks"] = report.Checks
+	} else if failed := report.Failed(); len(failed) > 0 {
+		resp["checks"] = failed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 func handleHealthzText(w http.ResponseWriter, r *http.Request) {
+	report := healthReport(r)
+
 	w.Header().Set("Content-Type", "text/plain")
-	fmt.Fprint(w, "OK")
+	if !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	switch report.Status {
+	case health.Healthy:
+		fmt.Fprint(w, "OK")
+	default:
+		fmt.Fprint(w, strings.ToUpper(report.Status))
+		for _, c := range report.Failed() {
+			if c.Message == "" {
+				fmt.Fprintf(w, "\n%s: %s", c.Name, c.Status)
+			} else {
+				fmt.Fprintf(w, "\n%s: %s", c.Name, c.Message)
+			}
+		}
+	}
+}
+
+// handleLiveness reports that the process is up and serving requests
+func handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "alive",
+	})
+}
+
+// handleReadiness reports whether the critical health checks pass
+func handleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := healthChecks.Run(r.Context())
+
+	resp := map[string]interface{}{
+		"status": "ready",
+	}
+	if !report.Ready() {
+		var failed []string
+		for _, c := range report.Failed() {
+			if c.Critical && c.Status == health.StatusFail {
+				failed = append(failed, c.Name)
+			}
+		}
+		resp["status"] = "not ready"
+		resp["failed"] = failed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// certificateHealth fails on expired certificates and warns on expiring ones
+func certificateHealth(certs []ssl.CertInfo) error {
+	var expiring []string
+	for _, c := range certs {
+		switch c.Status {
+		case "expired":
+			return fmt.Errorf("certificate %s expired on %s", c.Subject, c.NotAfter.Format(time.RFC3339))
+		case "critical", "expiring":
+			expiring = append(expiring, fmt.Sprintf("%s (%d days)", c.Subject, c.DaysLeft))
+		}
+	}
+	if len(expiring) > 0 {
+		return health.Warn("certificate expiring: %s", strings.Join(expiring, ", "))
+	}
+	return nil
 }
 
 func handleAPIInfo(w http.ResponseWriter, r *http.Request) {
@@ -358,7 +743,7 @@ func handleAPIInfo(w http.ResponseWriter, r *http.Request) {
 			"random":   "/api/v1/random",
 			"messages": "/api/v1/messages",
 			"stats":    "/api/v1/stats",
-			"reset":    "/api/v1/reset (POST)",
+			"reset":    "/api/v1/reset (POST, token with data:write)",
 		},
 	})
 }
@@ -366,12 +751,7 @@ func handleAPIInfo(w http.ResponseWriter, r *http.Request) {
 func handleRandom(w http.ResponseWriter, r *http.Request) {
 	msg, err := msgManager.GetRandom()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		writeJSONError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -391,7 +771,7 @@ func handleRandomText(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
+		fmt.Fprintf(w, "%s\nRequest ID: %s\n", err.Error(), middleware.GetRequestID(r.Context()))
 		return
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -401,12 +781,7 @@ func handleRandomText(w http.ResponseWriter, r *http.Request) {
 func handleMessages(w http.ResponseWriter, r *http.Request) {
 	data, err := msgManager.GetAllJSON()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		writeJSONError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -441,16 +816,16 @@ func handleStatsText(w http.ResponseWriter, r *http.Request) {
 
 func handleReset(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Method not allowed, use POST",
-		})
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed, use POST")
 		return
 	}
 
+	before := msgManager.Stats()
 	msgManager.ResetCycle()
+	e := admin.AuditEvent(r, audit.ActionCycleReset, true)
+	e.Detail = fmt.Sprintf("cycle %v reset with %v of %v messages used", before["cycle"], before["used_in_cycle"], before["total_messages"])
+	auditLog.Record(e)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -458,26 +833,94 @@ func handleReset(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// messageStatus reports message serving and cycle progress for the admin
+// dashboard
+func messageStatus() interface{} {
+	stats := msgManager.Stats()
+	total, _ := stats["total_messages"].(int)
+	used, _ := stats["used_in_cycle"].(int)
+	progress := 0.0
+	if total > 0 {
+		progress = math.Round(1000*float64(used)/float64(total)) / 10
+	}
+	return map[string]interface{}{
+		"cycle":         stats["cycle"],
+		"total":         total,
+		"used_in_cycle": used,
+		"remaining":     stats["remaining_in_cycle"],
+		"progress":      progress,
+		"served":        msgManager.Served(),
+	}
+}
+
+// auditReload records a configuration reload not started through the
+// admin API
+func auditReload(actor string, changes []config.Change, err error) {
+	e := audit.Event{Action: audit.ActionConfigReload, Actor: actor, Success: err == nil, Changes: changes}
+	if err != nil {
+		e.Detail = err.Error()
+	}
+	auditLog.Record(e)
+}
+
+// auditWatcherReload records reloads started by the config file watcher
+func auditWatcherReload(changes []config.Change, err error) {
+	auditReload(audit.ActorWatcher, changes, err)
+}
+
+// restartKeys are config keys (or key prefixes ending in ".") that are only
+// read at startup; server.http is reported by applyHTTPConfig
+var restartKeys = []string{
+	"server.port",
+	"server.fqdn",
+	"server.address",
+	"server.socket_mode",
+	"server.socket_activation",
+	"server.ssl.",
+	"server.session.store",
+}
+
+// needsRestart reports whether a changed key requires a restart
+func needsRestart(key string) bool {
+	for _, k := range restartKeys {
+		if key == k || (strings.HasSuffix(k, ".") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// origin: "*", the origin itself when it is listed, or "" when it is not
+func allowedOrigin(cors, origin string) string {
+	if cors == "*" {
+		return "*"
+	}
+	for _, allowed := range strings.Split(cors, ",") {
+		if strings.TrimSpace(allowed) == origin && origin != "" {
+			return origin
+		}
+	}
+	return ""
+}
+
 func handleRobotsTxt(w http.ResponseWriter, r *http.Request) {
+	robots := config.Get().WebRobots
 	w.Header().Set("Content-Type", "text/plain")
 	fmt.Fprintln(w, "User-agent: *")
-	if cfg != nil {
-		for _, path := range cfg.WebRobots.Allow {
-			fmt.Fprintf(w, "Allow: %s\n", path)
-		}
-		for _, path := range cfg.WebRobots.Deny {
-			fmt.Fprintf(w, "Disallow: %s\n", path)
-		}
-	} else {
-		fmt.Fprintln(w, "Allow: /")
+	for _, path := range robots.Allow {
+		fmt.Fprintf(w, "Allow: %s\n", path)
+	}
+	for _, path := range robots.Deny {
+		fmt.Fprintf(w, "Disallow: %s\n", path)
 	}
 }
 
 func handleSecurityTxt(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	admin := "security@apimgr.us"
-	if cfg != nil && cfg.WebSecurity.Admin != "" {
-		admin = cfg.WebSecurity.Admin
+	if contact := config.Get().WebSecurity.Admin; contact != "" {
+		admin = contact
 	}
 	fmt.Fprintf(w, "Contact: mailto:%s\n", admin)
 	fmt.Fprintln(w, "Expires: 2026-12-31T23:59:59.000Z")
@@ -516,10 +959,13 @@ Usage: gitmessages [options]
 
 Options:
   --port PORT          Server port (default: from config or 8080)
+                       Use "HTTP,HTTPS" (e.g. "8080,8443") for dual ports
   --address ADDRESS    Server address (default: from config or 0.0.0.0)
   --config DIR         Configuration directory
   --version            Print version information
   --status             Check service status (for healthcheck)
+  --strict             Refuse to start with an invalid configuration
+  --set KEY=VALUE      Override a config key (repeatable, e.g. server.ssl.enabled=true)
   --help               Show this help message
 
 Service Commands:
@@ -535,32 +981,158 @@ Maintenance Commands:
   --maintenance backup [file]   Backup configuration
   --maintenance restore [file]  Restore from backup
   --maintenance update          Check for updates
+  --maintenance config-check    Validate the configuration file
+  --maintenance config-show     Show the effective configuration and sources
+  --maintenance hash-password [password]  Print an Argon2id hash for server.admin.password
+  --maintenance token create <name> --scope S... [--expires 90d]
+                                Create an admin API token (shown once)
+  --maintenance token list      List admin API tokens
+  --maintenance token rotate <id>  Replace a token's value (shown once)
+  --maintenance token revoke <id>  Delete an admin API token
+  --maintenance admin-2fa enable|disable|status|recovery-codes
+                                Manage TOTP two-factor login for the admin account
 
 Environment Variables:
   PORT         Server port
   ADDRESS      Server address
   CONFIG_DIR   Configuration directory
+  GITMESSAGES_<KEY>  Override a config key, e.g. GITMESSAGES_WEB_UI_THEME=light
 
 Configuration:
   Root:    /etc/apimgr/gitmessages/server.yml
   User:    ~/.config/apimgr/gitmessages/server.yml
   Docker:  /config/server.yml
 
+  server.toml or server.json is read instead when server.yml is absent.
+  Files named by "include:" and conf.d/*.yml|toml|json are merged on top,
+  in lexical order.
+
 `, Version)
 }
 
-func checkHealth(port string) error {
-	url := fmt.Sprintf("http://127.0.0.1:%s/healthz", port)
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
+// accessLogFormat returns the current server.logging.access_format
+func accessLogFormat() string {
+	return config.Get().Server.Logging.AccessFormat
+}
+
+// metricsRoute serves Prometheus metrics at server.metrics.endpoint. It sits
+// in front of the ServeMux, whose routes cannot change, so reloads can move
+// or disable the endpoint and change which metrics it includes.
+type metricsRoute struct {
+	mu       sync.RWMutex
+	endpoint string
+	handler  http.HandlerFunc
+}
+
+// Set serves the metrics selected by c, or nothing when they are disabled
+func (m *metricsRoute) Set(c config.MetricsConfig, sslManager *ssl.Manager) {
+	endpoint := ""
+	var handler http.HandlerFunc
+	if c.Enabled {
+		endpoint = c.Endpoint
+		if endpoint == "" {
+			endpoint = "/metrics"
+		}
+		registry := metrics.New()
+		if c.IncludeSystem {
+			metrics.RegisterRuntime(registry)
+		}
+		if c.IncludeApp && sslManager != nil {
+			registry.Gauge("gitmessages_ssl_certificate_expiry_days", "Days until a served certificate expires", func() []metrics.Sample {
+				var samples []metrics.Sample
+				for _, c := range sslManager.Certificates() {
+					samples = append(samples, metrics.Sample{
+						Labels: map[string]string{"source": c.Source, "subject": c.Subject},
+						Value:  time.Until(c.NotAfter).Hours() / 24,
+					})
+				}
+				return samples
+			})
+		}
+		handler = adminHandler.RequireToken(admin.ScopeStatusRead, registry.ServeHTTP)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpoint, m.handler = endpoint, handler
+}
+
+// Endpoint returns the metrics path, or "" when metrics are disabled
+func (m *metricsRoute) Endpoint() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.endpoint
+}
+
+// Middleware answers requests for the metrics endpoint and passes the rest
+// to next
+func (m *metricsRoute) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		endpoint, handler := m.endpoint, m.handler
+		m.mu.RUnlock()
+		if endpoint == "" || r.URL.Path != endpoint {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Named like a ServeMux route for the request stats
+		r.Pattern = "GET " + endpoint
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// openAccessLog opens the access log file in the logs directory
+func openAccessLog(logsDir string) (*log.Logger, error) {
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(logsDir, "access.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return log.New(f, "", 0), nil
+}
+
+// checkHealth queries the running server's detailed health endpoint
+func checkHealth(address, httpPort, httpsPort string) (health.Report, error) {
+	var report health.Report
+
+	base := fmt.Sprintf("http://127.0.0.1:%s", httpPort)
+	client := &http.Client{Timeout: 10 * time.Second}
+	if path, ok := unixSocketPath(address); ok {
+		base = "http://unix"
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	} else if httpPort == "" {
+		// HTTPS-only: the certificate will not match 127.0.0.1
+		base = fmt.Sprintf("https://127.0.0.1:%s", httpsPort)
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	resp, err := client.Get(base + "/api/v1/healthz?verbose=1")
 	if err != nil {
-		return err
+		return report, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return report, fmt.Errorf("health check returned status %d", resp.StatusCode)
 	}
-	return nil
+	if !report.Ready() || resp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("service is %s", report.Status)
+	}
+	return report, nil
 }
 
 func handleServiceCommand(cmd, configDir string) {
@@ -598,7 +1170,7 @@ func handleMaintenanceCommand(cmd, configDir, dataDir, logsDir string) {
 		} else {
 			backupDir := paths.GetBackupDir()
 			if err := os.MkdirAll(backupDir, 0755); err != nil {
-				log.Fatalf("Failed to create backup directory: %v", err)
+				logging.Fatalf("Failed to create backup directory: %v", err)
 			}
 			timestamp := time.Now().Format("20060102-150405")
 			backupFile = filepath.Join(backupDir, fmt.Sprintf("gitmessages-backup-%s.tar.gz", timestamp))
@@ -630,6 +1202,16 @@ func handleMaintenanceCommand(cmd, configDir, dataDir, logsDir string) {
 		}
 	case "setup":
 		runSetupWizard(configDir)
+	case "config-check":
+		maintenanceConfigCheck(filepath.Join(configDir, "server.yml"))
+	case "config-show":
+		maintenanceConfigShow()
+	case "hash-password":
+		maintenanceHashPassword(args)
+	case "token":
+		maintenanceToken(args, dataDir)
+	case "admin-2fa":
+		maintenanceAdmin2FA(args, configDir, dataDir)
 	default:
 		fmt.Printf("Unknown maintenance command: %s\n", cmd)
 		os.Exit(1)
@@ -697,28 +1279,14 @@ func serviceInstall(configDir string) {
 	fmt.Println("Installing gitmessages service...")
 	switch runtime.GOOS {
 	case "linux":
-		service := fmt.Sprintf(`[Unit]
-Description=GitMessages Server
-After=network.target
-
-[Service]
-Type=simple
-ExecStart=/usr/local/bin/gitmessages --config %s
-Restart=always
-RestartSec=5
-User=gitmessages
-Group=gitmessages
-
-[Install]
-WantedBy=multi-user.target
-`, configDir)
-		if err := os.WriteFile("/etc/systemd/system/gitmessages.service", []byte(service), 0644); err != nil {
-			log.Fatalf("Failed to write systemd service file: %v", err)
+		opts := svc.InstallOptions{ConfigDir: configDir}
+		if cfg.Server.SocketActivation {
+			opts.ListenStreams = socketListenStreams(cfg.Server)
+			opts.SocketMode = cfg.Server.SocketMode
+		}
+		if err := svc.InstallWithOptions(opts); err != nil {
+			logging.Fatalf("Failed to install service: %v", err)
 		}
-		runCommand("systemctl", "daemon-reload")
-		runCommand("systemctl", "enable", "gitmessages")
-		runCommand("systemctl", "start", "gitmessages")
-		fmt.Println("Service installed and started successfully")
 	case "darwin":
 		plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
@@ -740,7 +1308,7 @@ WantedBy=multi-user.target
 </plist>
 `, configDir)
 		if err := os.WriteFile("/Library/LaunchDaemons/us.apimgr.gitmessages.plist", []byte(plist), 0644); err != nil {
-			log.Fatalf("Failed to write launchd plist: %v", err)
+			logging.Fatalf("Failed to write launchd plist: %v", err)
 		}
 		runCommand("launchctl", "load", "/Library/LaunchDaemons/us.apimgr.gitmessages.plist")
 		fmt.Println("Service installed and started successfully")
@@ -753,10 +1321,9 @@ func serviceUninstall() {
 	fmt.Println("Uninstalling gitmessages service...")
 	switch runtime.GOOS {
 	case "linux":
-		runCommand("systemctl", "stop", "gitmessages")
-		runCommand("systemctl", "disable", "gitmessages")
-		os.Remove("/etc/systemd/system/gitmessages.service")
-		runCommand("systemctl", "daemon-reload")
+		if err := svc.Uninstall(); err != nil {
+			logging.Fatalf("Failed to uninstall service: %v", err)
+		}
 	case "darwin":
 		runCommand("launchctl", "unload", "/Library/LaunchDaemons/us.apimgr.gitmessages.plist")
 		os.Remove("/Library/LaunchDaemons/us.apimgr.gitmessages.plist")
@@ -780,19 +1347,282 @@ func maintenanceBackup(configDir, backupFile string) {
 	fmt.Printf("Creating backup: %s\n", backupFile)
 	cmd := exec.Command("tar", "-czf", backupFile, "-C", filepath.Dir(configDir), filepath.Base(configDir))
 	if err := cmd.Run(); err != nil {
-		log.Fatalf("Backup failed: %v", err)
+		logging.Fatalf("Backup failed: %v", err)
 	}
 	fmt.Printf("Backup created successfully: %s\n", backupFile)
 }
 
+func maintenanceConfigCheck(configPath string) {
+	configPath = config.ResolvePath(configPath)
+	problems, err := config.ValidateFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintln(os.Stderr, &config.ValidationError{Path: configPath, Problems: problems})
+		os.Exit(1)
+	}
+	fmt.Printf("%s: OK\n", configPath)
+}
+
+// maintenanceToken creates, lists, rotates and revokes admin API tokens in
+// the data directory. A running server picks up changes on the next request.
+func maintenanceToken(args []string, dataDir string) {
+	usage := func() {
+		fmt.Println("Usage: gitmessages --maintenance token create <name> --scope S [--scope S]... [--expires DURATION]")
+		fmt.Println("       gitmessages --maintenance token list")
+		fmt.Println("       gitmessages --maintenance token rotate <id>")
+		fmt.Println("       gitmessages --maintenance token revoke <id>")
+		fmt.Printf("Scopes: %s, or %s for all of them\n", strings.Join(admin.Scopes, ", "), admin.ScopeAll)
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	store := admin.NewTokenStore(dataDir)
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("token create", flag.ExitOnError)
+		var scopes stringList
+		fs.Var(&scopes, "scope", "Scope to grant (repeatable, at least one)")
+		expires := fs.String("expires", "", "Lifetime, e.g. 720h or 90d (default: never)")
+		if len(args) < 2 {
+			usage()
+		}
+		fs.Parse(args[2:])
+		ttl, err := admin.ParseTTL(*expires)
+		if err != nil {
+			logging.Fatalf("Failed to create token: %v", err)
+		}
+		token, secret, err := store.Create(args[1], scopes, ttl)
+		if err != nil {
+			logging.Fatalf("Failed to create token: %v", err)
+		}
+		fmt.Printf("Created token %s (%s)\n", token.ID, token.Name)
+		fmt.Println("Store it now, it will not be shown again:")
+		fmt.Println(secret)
+	case "list":
+		tokens, err := store.List()
+		if err != nil {
+			logging.Fatalf("Failed to list tokens: %v", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tEXPIRES\tLAST USED")
+		for _, t := range tokens {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Permissions, ","),
+				formatTokenTime(t.CreatedAt, ""), formatTokenTime(t.ExpiresAt, "never"), formatTokenTime(t.LastUsed, "never"))
+		}
+		tw.Flush()
+	case "rotate":
+		if len(args) < 2 {
+			usage()
+		}
+		token, secret, err := store.Rotate(args[1])
+		if err != nil {
+			logging.Fatalf("Failed to rotate token: %v", err)
+		}
+		fmt.Printf("Rotated token %s (%s)\n", token.ID, token.Name)
+		fmt.Println("Store it now, it will not be shown again:")
+		fmt.Println(secret)
+	case "revoke":
+		if len(args) < 2 {
+			usage()
+		}
+		if err := store.Revoke(args[1]); err != nil {
+			logging.Fatalf("Failed to revoke token: %v", err)
+		}
+		fmt.Printf("Revoked token %s\n", args[1])
+	default:
+		usage()
+	}
+}
+
+// recoveryCodeCount is the number of recovery codes issued at a time
+const recoveryCodeCount = 10
+
+// maintenanceAdmin2FA enables, disables and reports the TOTP second factor
+// of the admin login
+func maintenanceAdmin2FA(args []string, configDir, dataDir string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: gitmessages --maintenance admin-2fa enable|disable|status|recovery-codes")
+		os.Exit(1)
+	}
+	tf := admin.NewTwoFactor(dataDir)
+
+	switch args[0] {
+	case "enable":
+		if tf.Enabled() {
+			logging.Fatalf("Two-factor authentication is already enabled; disable it first to enrol a new device")
+		}
+		account := "admin"
+		if cfg, err := config.Load(filepath.Join(configDir, "server.yml")); err == nil {
+			account = cfg.Server.Admin.Username
+			if cfg.Server.FQDN != "" {
+				account += "@" + cfg.Server.FQDN
+			}
+		}
+
+		secret := admin.NewTOTPSecret()
+		uri := admin.TOTPURI(secret, account, admin.TOTPIssuer)
+		if code, err := admin.TerminalQR(uri); err == nil {
+			fmt.Println(code)
+		}
+		fmt.Println("Scan the QR code with your authenticator app, or add this URI:")
+		fmt.Println(uri)
+		fmt.Printf("Secret: %s\n\n", secret)
+
+		fmt.Print("Enter the code shown by the app to confirm: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			logging.Fatalf("Failed to read code: %v", err)
+		}
+		if !admin.ValidateTOTP(secret, strings.TrimSpace(line), time.Now()) {
+			logging.Fatalf("Invalid code, two-factor authentication not enabled")
+		}
+
+		codes := admin.NewRecoveryCodes(recoveryCodeCount)
+		if err := tf.Enable(secret, codes); err != nil {
+			logging.Fatalf("Failed to enable two-factor authentication: %v", err)
+		}
+		fmt.Println("Two-factor authentication enabled.")
+		printRecoveryCodes(codes)
+	case "disable":
+		if err := tf.Disable(); err != nil {
+			logging.Fatalf("%v", err)
+		}
+		fmt.Println("Two-factor authentication disabled.")
+	case "status":
+		if !tf.Enabled() {
+			fmt.Println("Two-factor authentication: disabled")
+			return
+		}
+		fmt.Println("Two-factor authentication: enabled")
+		fmt.Printf("Recovery codes left: %d\n", tf.RecoveryCodesLeft())
+	case "recovery-codes":
+		codes, err := tf.RegenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			logging.Fatalf("Failed to create recovery codes: %v", err)
+		}
+		fmt.Println("Previous recovery codes no longer work.")
+		printRecoveryCodes(codes)
+	default:
+		fmt.Printf("Unknown admin-2fa command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// printRecoveryCodes shows recovery codes with a warning that they are
+// only displayed once
+func printRecoveryCodes(codes []string) {
+	fmt.Println("Recovery codes, each usable once if you lose the device. Store them now, they will not be shown again:")
+	for _, c := range codes {
+		fmt.Printf("  %s\n", c)
+	}
+}
+
+// formatTokenTime formats a token timestamp, or empty for the zero time
+func formatTokenTime(t time.Time, empty string) string {
+	if t.IsZero() {
+		return empty
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// storeAdminPasswordHash writes an upgraded admin password hash to the
+// config file. Passwords from password_file, the environment, --set or an
+// include are not rewritten.
+func storeAdminPasswordHash(hash string) error {
+	return config.SetFileValue("server.admin.password", hash)
+}
+
+// maintenanceHashPassword prints the Argon2id hash, at the configured cost,
+// of a password given as an argument, typed at a prompt or read from stdin
+func maintenanceHashPassword(args []string) {
+	var password string
+	switch {
+	case len(args) > 0:
+		password = args[0]
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		fmt.Fprint(os.Stderr, "Password: ")
+		first, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			logging.Fatalf("Failed to read password: %v", err)
+		}
+		fmt.Fprint(os.Stderr, "Confirm password: ")
+		second, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			logging.Fatalf("Failed to read password: %v", err)
+		}
+		if string(first) != string(second) {
+			fmt.Fprintln(os.Stderr, "Passwords do not match")
+			os.Exit(1)
+		}
+		password = string(first)
+	default:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			logging.Fatalf("Failed to read password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "Password must not be empty")
+		os.Exit(1)
+	}
+	params := admin.Argon2ParamsFromConfig(config.Get().Server.Admin.Argon2)
+	hash, err := admin.HashPasswordWith(password, params)
+	if err != nil {
+		logging.Fatalf("Failed to hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
+
+// maintenanceConfigShow prints the effective configuration and the source
+// of every value. Secrets are masked.
+func maintenanceConfigShow() {
+	current := config.Get()
+	sources := config.Sources()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range config.Keys() {
+		value, _ := config.GetKey(current, key)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, formatConfigValue(key, value), sources[key])
+	}
+	w.Flush()
+}
+
+// formatConfigValue formats a config value for display
+func formatConfigValue(key string, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if v != "" && config.IsSecretKey(key) {
+			return `"********"`
+		}
+		return strconv.Quote(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func maintenanceRestore(backupFile, configDir string) {
 	fmt.Printf("Restoring from backup: %s\n", backupFile)
 	if _, err := os.Stat(backupFile); os.IsNotExist(err) {
-		log.Fatalf("Backup file not found: %s", backupFile)
+		logging.Fatalf("Backup file not found: %s", backupFile)
 	}
 	cmd := exec.Command("tar", "-xzf", backupFile, "-C", "/")
 	if err := cmd.Run(); err != nil {
-		log.Fatalf("Restore failed: %v", err)
+		logging.Fatalf("Restore failed: %v", err)
 	}
 	fmt.Println("Restore completed successfully")
 }
@@ -809,32 +1639,26 @@ func runCommand(name string, args ...string) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		log.Printf("Command failed: %s %v: %v", name, args, err)
+		logging.Errorf("Command failed: %s %v: %v", name, args, err)
 	}
 }
 
 // setApplicationMode sets the application mode in config
 func setApplicationMode(mode, configPath string) {
-	validModes := map[string]bool{
-		"production":  true,
-		"development": true,
-		"debug":       true,
-	}
-
-	if !validModes[mode] {
+	if !config.ValidMode(mode) {
 		fmt.Printf("Invalid mode: %s\n", mode)
-		fmt.Println("Valid modes: production, development, debug")
+		fmt.Println("Valid modes: production, development")
 		os.Exit(1)
 	}
 
 	currentCfg, err := config.Load(configPath)
 	if err != nil {
-		currentCfg = config.DefaultConfig()
+		logging.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	currentCfg.Server.Mode = mode
 	if err := config.Save(); err != nil {
-		log.Fatalf("Failed to save configuration: %v", err)
+		logging.Fatalf("Failed to save configuration: %v", err)
 	}
 
 	fmt.Printf("Application mode set to: %s\n", mode)
@@ -866,7 +1690,7 @@ func handleUpdateCommand(cmd string, currentCfg *config.Config) {
 			}
 			currentCfg.Server.UpdateBranch = branch
 			if err := config.Save(); err != nil {
-				log.Fatalf("Failed to save configuration: %v", err)
+				logging.Fatalf("Failed to save configuration: %v", err)
 			}
 			fmt.Printf("Update branch set to: %s\n", branch)
 		} else {
@@ -885,7 +1709,7 @@ func runSetupWizard(configDir string) {
 
 	// Ensure config directory exists
 	if err := os.MkdirAll(configDir, 0755); err != nil {
-		log.Fatalf("Failed to create config directory: %v", err)
+		logging.Fatalf("Failed to create config directory: %v", err)
 	}
 
 	configPath := filepath.Join(configDir, "server.yml")
@@ -894,7 +1718,7 @@ func runSetupWizard(configDir string) {
 		currentCfg = config.DefaultConfig()
 	}
 
-	fmt.Printf("Configuration file: %s\n", configPath)
+	fmt.Printf("Configuration file: %s\n", config.ResolvePath(configPath))
 	fmt.Printf("Current mode: %s\n", currentCfg.Server.Mode)
 	fmt.Printf("Current port: %s\n", currentCfg.Server.Port)
 	fmt.Println()
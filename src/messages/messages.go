@@ -17,6 +17,7 @@ type Manager struct {
 	messages    []string
 	usedIndexes map[int]bool
 	cycle       int
+	served      uint64
 	mu          sync.RWMutex
 }
 
@@ -59,6 +60,7 @@ func (m *Manager) GetRandom() (string, error) {
 	if len(m.messages) == 0 {
 		return "", fmt.Errorf("no messages available")
 	}
+	m.served++
 
 	// Check if all messages have been used
 	if len(m.usedIndexes) >= len(m.messages) {
@@ -121,6 +123,13 @@ func (m *Manager) Stats() map[string]interface{} {
 	}
 }
 
+// Served returns the number of random messages handed out since start
+func (m *Manager) Served() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.served
+}
+
 // ResetCycle manually resets to a new cycle
 func (m *Manager) ResetCycle() {
 	m.mu.Lock()
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sample is one value of a gauge with its labels
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Value returns a single unlabelled sample
+func Value(v float64) []Sample {
+	return []Sample{{Value: v}}
+}
+
+// gauge is a metric whose samples are collected at scrape time
+type gauge struct {
+	name    string
+	help    string
+	collect func() []Sample
+}
+
+// Registry serves gauges in the Prometheus text exposition format
+type Registry struct {
+	mu     sync.RWMutex
+	gauges []gauge
+}
+
+// New creates an empty registry
+func New() *Registry {
+	return &Registry{}
+}
+
+// Gauge adds a gauge; collect is called on every scrape
+func (r *Registry) Gauge(name, help string, collect func() []Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gauge{name: name, help: help, collect: collect})
+}
+
+// RegisterRuntime adds Go runtime gauges
+func RegisterRuntime(r *Registry) {
+	r.Gauge("go_goroutines", "Number of goroutines", func() []Sample {
+		return Value(float64(runtime.NumGoroutine()))
+	})
+	r.Gauge("go_memstats_alloc_bytes", "Bytes of allocated heap objects", func() []Sample {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return Value(float64(m.Alloc))
+	})
+	r.Gauge("go_memstats_sys_bytes", "Bytes obtained from the operating system", func() []Sample {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return Value(float64(m.Sys))
+	})
+}
+
+// ServeHTTP writes every gauge
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.RLock()
+	gauges := append([]gauge(nil), r.gauges...)
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, s := range g.collect() {
+			fmt.Fprintf(w, "%s%s %s\n", g.name, labels(s.Labels), strconv.FormatFloat(s.Value, 'g', -1, 64))
+		}
+	}
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats a label set, sorted by name
+func labels(l map[string]string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelEscaper.Replace(l[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// responseRecorder captures the status code and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer supports it
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// AccessLog writes one line per request to logger in the format returned
+// by format, which is read for every request so it can change while
+// running. Supported formats are "apache" (combined log format) and
+// "json". The request ID is included in both formats.
+func AccessLog(logger *log.Logger, format func() string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			logger.Print(formatAccessLog(format(), r, rec, start))
+		})
+	}
+}
+
+// formatAccessLog renders a single access log entry
+func formatAccessLog(format string, r *http.Request, rec *responseRecorder, start time.Time) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	requestID := GetRequestID(r.Context())
+
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"time":       start.Format(time.RFC3339),
+			"remote":     host,
+			"method":     r.Method,
+			"path":       r.URL.RequestURI(),
+			"proto":      r.Proto,
+			"status":     rec.status,
+			"bytes":      rec.bytes,
+			"duration":   time.Since(start).String(),
+			"referer":    r.Referer(),
+			"user_agent": r.UserAgent(),
+			"request_id": requestID,
+		})
+		return string(data)
+	}
+
+	return fmt.Sprintf("%s - - [%s] %q %d %d %q %q %s",
+		host,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.URL.RequestURI()+" "+r.Proto,
+		rec.status,
+		rec.bytes,
+		r.Referer(),
+		r.UserAgent(),
+		requestID,
+	)
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogFollowsFormatChanges(t *testing.T) {
+	var out bytes.Buffer
+	format := "apache"
+	handler := AccessLog(log.New(&out, "", 0), func() string { return format })(http.NotFoundHandler())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	format = "json"
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2", len(lines))
+	}
+	if !strings.Contains(lines[0], `"GET /a HTTP/1.1" 404`) {
+		t.Errorf("first line %q is not in apache format", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "{") || !strings.Contains(lines[1], `"/b"`) {
+		t.Errorf("second line %q is not in json format", lines[1])
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/apimgr/gitmessages/src/logging"
+	"github.com/apimgr/gitmessages/src/mode"
+)
+
+// Recover catches panics raised by downstream handlers, logs the stack
+// trace and replies with a 500 in the format the client asked for.
+// The stack trace is only included in the response in development mode.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// Let net/http abort the connection as intended
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			requestID := GetRequestID(r.Context())
+			if requestID == "" {
+				requestID = newRequestID()
+			}
+
+			stack := debug.Stack()
+			logging.Errorf("panic: %v [request_id=%s] %s %s\n%s", rec, requestID, r.Method, r.URL.Path, stack)
+
+			writePanicResponse(w, r, rec, stack, requestID)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writePanicResponse writes the 500 response for a recovered panic
+func writePanicResponse(w http.ResponseWriter, r *http.Request, rec interface{}, stack []byte, requestID string) {
+	err, ok := rec.(error)
+	if !ok {
+		err = fmt.Errorf("%v", rec)
+	}
+	verbose := mode.GetPanicRecoveryMode() == "verbose"
+
+	w.Header().Set(RequestIDHeader, requestID)
+
+	if WantsText(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Internal Server Error: %s\n", mode.GetErrorDetail(err))
+		fmt.Fprintf(w, "Request ID: %s\n", requestID)
+		if verbose {
+			fmt.Fprintf(w, "\n%s", stack)
+		}
+		return
+	}
+
+	body := map[string]interface{}{
+		"success":    false,
+		"error":      mode.GetErrorDetail(err),
+		"request_id": requestID,
+	}
+	if verbose {
+		body["stack"] = strings.Split(strings.TrimSpace(string(stack)), "\n")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(body)
+}
+
+// WantsText reports whether the client asked for a plain text response,
+// either through a .txt endpoint or an Accept header preferring text/plain
+func WantsText(r *http.Request) bool {
+	if strings.HasSuffix(r.URL.Path, ".txt") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.HasPrefix(accept, "text/plain")
+}
+
+// newRequestID generates a random request identifier
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
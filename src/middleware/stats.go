@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsWindow is how many seconds of per-second counts are kept for rates
+const statsWindow = 15 * 60
+
+// topEndpoints is the number of endpoints reported by Snapshot
+const topEndpoints = 10
+
+// notFoundEndpoint groups requests that matched no route
+const notFoundEndpoint = "(not found)"
+
+// statsBucket counts the requests of one second
+type statsBucket struct {
+	second   int64
+	requests uint32
+	errors   uint32
+}
+
+// endpointCounts accumulates the requests of one route
+type endpointCounts struct {
+	requests uint64
+	errors   uint64
+	duration time.Duration
+}
+
+// Stats counts requests, errors and per-route totals for the admin
+// dashboard. Routes are ServeMux patterns, so the number of endpoints is
+// bounded. Errors are responses with a 5xx status.
+type Stats struct {
+	mu           sync.Mutex
+	now          func() time.Time
+	requests     uint64
+	clientErrors uint64
+	serverErrors uint64
+	endpoints    map[string]*endpointCounts
+	buckets      [statsWindow]statsBucket
+}
+
+// EndpointStats is the traffic of one route
+type EndpointStats struct {
+	Endpoint   string  `json:"endpoint"`
+	Requests   uint64  `json:"requests"`
+	Errors     uint64  `json:"errors"`
+	AvgLatency float64 `json:"avg_latency_ms"`
+}
+
+// StatsSnapshot is the traffic since start and over recent windows. Rates
+// are requests per second; error rates are the share of 5xx responses.
+type StatsSnapshot struct {
+	Requests     uint64          `json:"requests"`
+	ClientErrors uint64          `json:"client_errors"`
+	ServerErrors uint64          `json:"server_errors"`
+	Rate1m       float64         `json:"rate_1m"`
+	Rate5m       float64         `json:"rate_5m"`
+	Rate15m      float64         `json:"rate_15m"`
+	ErrorRate1m  float64         `json:"error_rate_1m"`
+	ErrorRate5m  float64         `json:"error_rate_5m"`
+	TopEndpoints []EndpointStats `json:"top_endpoints"`
+}
+
+// NewStats creates an empty request counter
+func NewStats() *Stats {
+	return &Stats{now: time.Now, endpoints: make(map[string]*endpointCounts)}
+}
+
+// Middleware counts every request handled by next, which should be the
+// ServeMux so the matched route is known afterwards. A panic in next is
+// counted as a 500, the response Recover sends further out, and goes on up
+// to it.
+func (s *Stats) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := s.now()
+		rec := &responseRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			status := rec.status
+			switch {
+			case !completed:
+				status = http.StatusInternalServerError
+			case status == 0:
+				status = http.StatusOK
+			}
+			endpoint := r.Pattern
+			if endpoint == "" || status == http.StatusNotFound {
+				endpoint = notFoundEndpoint
+			}
+			s.record(endpoint, status, s.now().Sub(start))
+		}()
+
+		next.ServeHTTP(rec, r)
+		completed = true
+	})
+}
+
+// record counts one finished request
+func (s *Stats) record(endpoint string, status int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := status >= 500
+	s.requests++
+	switch {
+	case failed:
+		s.serverErrors++
+	case status >= 400:
+		s.clientErrors++
+	}
+
+	e, ok := s.endpoints[endpoint]
+	if !ok {
+		e = &endpointCounts{}
+		s.endpoints[endpoint] = e
+	}
+	e.requests++
+	e.duration += d
+	if failed {
+		e.errors++
+	}
+
+	sec := s.now().Unix()
+	b := &s.buckets[sec%statsWindow]
+	if b.second != sec {
+		*b = statsBucket{second: sec}
+	}
+	b.requests++
+	if failed {
+		b.errors++
+	}
+}
+
+// window sums the requests and errors of the last seconds. Callers hold
+// s.mu.
+func (s *Stats) window(now int64, seconds int64) (requests, errors uint64) {
+	for i := int64(0); i < seconds; i++ {
+		sec := now - i
+		if b := s.buckets[sec%statsWindow]; b.second == sec {
+			requests += uint64(b.requests)
+			errors += uint64(b.errors)
+		}
+	}
+	return requests, errors
+}
+
+// Snapshot returns the current counts and rates
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		Requests:     s.requests,
+		ClientErrors: s.clientErrors,
+		ServerErrors: s.serverErrors,
+		TopEndpoints: []EndpointStats{},
+	}
+
+	// The current second is incomplete, so windows end at the last one
+	now := s.now().Unix() - 1
+	rate := func(seconds int64) (float64, float64) {
+		requests, errors := s.window(now, seconds)
+		if requests == 0 {
+			return 0, 0
+		}
+		return float64(requests) / float64(seconds), float64(errors) / float64(requests)
+	}
+	snap.Rate1m, snap.ErrorRate1m = rate(60)
+	snap.Rate5m, snap.ErrorRate5m = rate(5 * 60)
+	snap.Rate15m, _ = rate(statsWindow)
+
+	for name, e := range s.endpoints {
+		snap.TopEndpoints = append(snap.TopEndpoints, EndpointStats{
+			Endpoint:   name,
+			Requests:   e.requests,
+			Errors:     e.errors,
+			AvgLatency: float64(e.duration.Microseconds()) / float64(e.requests) / 1000,
+		})
+	}
+	sort.Slice(snap.TopEndpoints, func(i, j int) bool {
+		a, b := snap.TopEndpoints[i], snap.TopEndpoints[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	if len(snap.TopEndpoints) > topEndpoints {
+		snap.TopEndpoints = snap.TopEndpoints[:topEndpoints]
+	}
+	return snap
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatsCountsPanicAsServerError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	stats := NewStats()
+	// As in main, Recover wraps the stats middleware
+	handler := Recover(stats.Middleware(mux))
+
+	for _, path := range []string{"/ok", "/panic", "/missing"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if path == "/panic" && rec.Code != http.StatusInternalServerError {
+			t.Errorf("panic answered %d, want 500 from Recover", rec.Code)
+		}
+	}
+
+	snap := stats.Snapshot()
+	if snap.Requests != 3 || snap.ServerErrors != 1 || snap.ClientErrors != 1 {
+		t.Errorf("requests %d, server errors %d, client errors %d; want 3, 1, 1",
+			snap.Requests, snap.ServerErrors, snap.ClientErrors)
+	}
+	errors := map[string]uint64{}
+	for _, e := range snap.TopEndpoints {
+		errors[e.Endpoint] = e.Errors
+	}
+	if errors["GET /panic"] != 1 || errors["GET /ok"] != 0 {
+		t.Errorf("endpoint errors = %v, want 1 for GET /panic", errors)
+	}
+}
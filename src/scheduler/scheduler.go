@@ -1,11 +1,17 @@
 package scheduler
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/apimgr/gitmessages/src/logging"
 )
 
+// tickInterval is how often the scheduler checks for due tasks
+const tickInterval = 30 * time.Second
+
 // Task represents a scheduled task
 type Task struct {
 	Name     string
@@ -18,10 +24,11 @@ type Task struct {
 
 // Scheduler manages periodic tasks
 type Scheduler struct {
-	tasks   map[string]*Task
-	stop    chan struct{}
-	running bool
-	mu      sync.RWMutex
+	tasks    map[string]*Task
+	stop     chan struct{}
+	running  bool
+	lastTick time.Time
+	mu       sync.RWMutex
 }
 
 // New creates a new scheduler
@@ -82,13 +89,14 @@ func (s *Scheduler) Start() {
 		return
 	}
 	s.running = true
+	s.lastTick = time.Now()
 	s.stop = make(chan struct{})
 	s.mu.Unlock()
 
 	log.Printf("Scheduler: Started with %d tasks", len(s.tasks))
 
 	go func() {
-		ticker := time.NewTicker(30 * time.Second) // Check every 30 seconds
+		ticker := time.NewTicker(tickInterval)
 		defer ticker.Stop()
 
 		for {
@@ -97,6 +105,9 @@ func (s *Scheduler) Start() {
 				log.Println("Scheduler: Stopped")
 				return
 			case <-ticker.C:
+				s.mu.Lock()
+				s.lastTick = time.Now()
+				s.mu.Unlock()
 				s.runDueTasks()
 			}
 		}
@@ -116,6 +127,21 @@ func (s *Scheduler) Stop() {
 	s.running = false
 }
 
+// Alive reports whether the scheduler loop is running and has ticked
+// recently
+func (s *Scheduler) Alive() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.running {
+		return fmt.Errorf("scheduler is not running")
+	}
+	if since := time.Since(s.lastTick); since > 2*tickInterval {
+		return fmt.Errorf("scheduler last ran %s ago", since.Round(time.Second))
+	}
+	return nil
+}
+
 // runDueTasks executes tasks that are due
 func (s *Scheduler) runDueTasks() {
 	s.mu.Lock()
@@ -133,7 +159,7 @@ func (s *Scheduler) runDueTasks() {
 		go func(t *Task) {
 			log.Printf("Scheduler: Running task '%s'", t.Name)
 			if err := t.Func(); err != nil {
-				log.Printf("Scheduler: Task '%s' failed: %v", t.Name, err)
+				logging.Errorf("Scheduler: Task '%s' failed: %v", t.Name, err)
 			} else {
 				log.Printf("Scheduler: Task '%s' completed", t.Name)
 			}
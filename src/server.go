@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/config"
+	"github.com/apimgr/gitmessages/src/logging"
+	"github.com/apimgr/gitmessages/src/ssl"
+)
+
+// parsePorts splits a port specification into HTTP and HTTPS ports.
+// "8080" serves HTTP only, "443" serves HTTPS only and "8080,8443" serves
+// both. sslEnabled turns a single non-443 port into an HTTPS port.
+func parsePorts(spec string, sslEnabled bool) (httpPort, httpsPort string, err error) {
+	parts := strings.Split(spec, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+		if err := validatePort(parts[i]); err != nil {
+			return "", "", err
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		if parts[0] == "443" || sslEnabled {
+			return "", parts[0], nil
+		}
+		return parts[0], "", nil
+	case 2:
+		if parts[0] == parts[1] {
+			return "", "", fmt.Errorf("HTTP and HTTPS ports must differ")
+		}
+		return parts[0], parts[1], nil
+	default:
+		return "", "", fmt.Errorf("expected PORT or HTTP_PORT,HTTPS_PORT")
+	}
+}
+
+// validatePort checks that a port is a number between 1 and 65535
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// listenAddr builds the listen address for a port. Unix socket addresses
+// are returned unchanged.
+func listenAddr(address, port string) string {
+	if _, ok := unixSocketPath(address); ok {
+		return address
+	}
+	if address == "0.0.0.0" || address == "::" {
+		return ":" + port
+	}
+	return fmt.Sprintf("%s:%s", address, port)
+}
+
+// newSSLConfig converts the server.ssl section into an ssl.Config
+func newSSLConfig(c config.SSLConfig, dataDir string) ssl.Config {
+	certPath := c.CertPath
+	if certPath == "" {
+		certPath = filepath.Join(dataDir, "ssl")
+	}
+	return ssl.Config{
+		Enabled:  true,
+		CertPath: certPath,
+		LetsEncrypt: ssl.LetsEncryptConfig{
+			Enabled:         c.LetsEncrypt.Enabled,
+			Email:           c.LetsEncrypt.Email,
+			Challenge:       ssl.ParseChallenge(c.LetsEncrypt.Challenge),
+			DirectoryURL:    c.LetsEncrypt.DirectoryURL,
+			CABundle:        c.LetsEncrypt.CABundle,
+			DNSProviderType: c.LetsEncrypt.DNSProvider,
+			DNSProviderKey:  c.LetsEncrypt.DNSProviderKey,
+			RFC2136Server:   c.LetsEncrypt.RFC2136Server,
+			RFC2136Zone:     c.LetsEncrypt.RFC2136Zone,
+			RFC2136Name:     c.LetsEncrypt.RFC2136Name,
+			RFC2136Algo:     c.LetsEncrypt.RFC2136Algo,
+		},
+	}
+}
+
+// sslDomains returns the domains certificates are requested for
+func sslDomains(fqdn string) []string {
+	var domains []string
+	for _, d := range strings.Split(fqdn, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		if hostname, err := os.Hostname(); err == nil {
+			domains = append(domains, hostname)
+		}
+	}
+	return domains
+}
+
+// connRequestsKey is the context key for the per-connection request count
+type connRequestsKey struct{}
+
+// keepAliveLimiter closes keep-alive connections after a configurable
+// number of requests. The limit can be changed while serving.
+type keepAliveLimiter struct {
+	max atomic.Int64
+}
+
+// ConnContext attaches a request counter to every new connection
+func (k *keepAliveLimiter) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey{}, new(atomic.Int64))
+}
+
+// Middleware asks the client to close the connection once the limit is
+// reached. HTTP/2 connections are shut down gracefully by the same header.
+func (k *keepAliveLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := k.max.Load(); limit > 0 {
+			if count, ok := r.Context().Value(connRequestsKey{}).(*atomic.Int64); ok && count.Add(1) >= limit {
+				w.Header().Set("Connection", "close")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// seconds converts a config value in seconds; zero or less means no limit
+func seconds(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// newServer creates an HTTP server; a non-nil tlsConfig makes it serve HTTPS
+func newServer(addr string, handler http.Handler, tlsConfig *tls.Config, c config.HTTPConfig, limiter *keepAliveLimiter) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           limiter.Middleware(handler),
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       seconds(c.ReadTimeout),
+		ReadHeaderTimeout: seconds(c.ReadHeaderTimeout),
+		WriteTimeout:      seconds(c.WriteTimeout),
+		IdleTimeout:       seconds(c.IdleTimeout),
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		ConnContext:       limiter.ConnContext,
+	}
+
+	// HTTPS negotiates HTTP/2 through ALPN; plain HTTP needs h2c for
+	// reverse proxies that speak HTTP/2 to their backends
+	if tlsConfig == nil && c.H2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	server.SetKeepAlivesEnabled(c.KeepAlive)
+	limiter.max.Store(int64(c.MaxRequestsPerConn))
+	return server
+}
+
+// applyHTTPConfig applies reloaded server.http settings to running servers.
+// Keep-alive settings change immediately; the rest needs a restart.
+func applyHTTPConfig(servers []*http.Server, old, c config.HTTPConfig, limiter *keepAliveLimiter) {
+	for _, server := range servers {
+		server.SetKeepAlivesEnabled(c.KeepAlive)
+	}
+	limiter.max.Store(int64(c.MaxRequestsPerConn))
+
+	var restart []string
+	if c.ReadTimeout != old.ReadTimeout {
+		restart = append(restart, "read_timeout")
+	}
+	if c.ReadHeaderTimeout != old.ReadHeaderTimeout {
+		restart = append(restart, "read_header_timeout")
+	}
+	if c.WriteTimeout != old.WriteTimeout {
+		restart = append(restart, "write_timeout")
+	}
+	if c.IdleTimeout != old.IdleTimeout {
+		restart = append(restart, "idle_timeout")
+	}
+	if c.MaxHeaderBytes != old.MaxHeaderBytes {
+		restart = append(restart, "max_header_bytes")
+	}
+	if c.H2C != old.H2C {
+		restart = append(restart, "h2c")
+	}
+	if len(restart) > 0 {
+		logging.Warnf("Changes to server.http %s take effect after a restart", strings.Join(restart, ", "))
+	}
+}
+
+// serve runs the server on l and reports its exit on errChan
+func serve(server *http.Server, l net.Listener, errChan chan<- error) {
+	if server.TLSConfig != nil {
+		errChan <- server.ServeTLS(l, "", "")
+		return
+	}
+	errChan <- server.Serve(l)
+}
@@ -58,13 +58,29 @@ func DetectServiceManager() ServiceType {
 	}
 }
 
+// InstallOptions customizes the installed service
+type InstallOptions struct {
+	// ListenStreams enables systemd socket activation with one socket per
+	// entry: a port, host:port or unix socket path (HTTP first, then HTTPS)
+	ListenStreams []string
+	// SocketMode sets the permissions of unix sockets created by systemd
+	SocketMode string
+	// ConfigDir is passed to the service as --config when set
+	ConfigDir string
+}
+
 // Install installs the service for the detected service manager
 func Install() error {
+	return InstallWithOptions(InstallOptions{})
+}
+
+// InstallWithOptions installs the service for the detected service manager
+func InstallWithOptions(opts InstallOptions) error {
 	serviceType := DetectServiceManager()
 
 	switch serviceType {
 	case ServiceSystemd:
-		return installSystemd()
+		return installSystemd(opts)
 	case ServiceRunit:
 		return installRunit()
 	case ServiceLaunchd:
@@ -108,16 +124,54 @@ func GetBinaryPath() string {
 	}
 }
 
-// installSystemd creates systemd service file
-func installSystemd() error {
+// SystemdSocketUnit generates a systemd .socket unit for socket activation.
+// Sockets are passed to the service in the order of listenStreams.
+func SystemdSocketUnit(listenStreams []string, socketMode string) string {
+	if socketMode == "" {
+		socketMode = "0660"
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=GitMessages API Server Socket\n\n")
+	b.WriteString("[Socket]\n")
+	for _, stream := range listenStreams {
+		fmt.Fprintf(&b, "ListenStream=%s\n", stream)
+	}
+	fmt.Fprintf(&b, "SocketMode=%s\n", socketMode)
+	b.WriteString("NoDelay=true\n\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=sockets.target\n")
+	return b.String()
+}
+
+// installSystemd creates systemd service file and, when requested, a
+// socket unit that starts the service on the first connection
+func installSystemd(opts InstallOptions) error {
 	binaryPath := GetBinaryPath()
+	socketActivated := len(opts.ListenStreams) > 0
+
+	execStart := binaryPath
+	readWritePaths := fmt.Sprintf("/var/lib/%s/%s /var/log/%s/%s /etc/%s/%s", orgName, appName, orgName, appName, orgName, appName)
+	if opts.ConfigDir != "" {
+		execStart += " --config " + opts.ConfigDir
+		if opts.ConfigDir != fmt.Sprintf("/etc/%s/%s", orgName, appName) {
+			// The admin settings editor writes to the config directory
+			readWritePaths += " " + opts.ConfigDir
+		}
+	}
+
+	socketDeps := ""
+	if socketActivated {
+		socketDeps = fmt.Sprintf("Requires=%s.socket\nAfter=%s.socket\n", appName, appName)
+	}
 
 	serviceContent := fmt.Sprintf(`[Unit]
 Description=GitMessages API Server
 Documentation=https://gitmessages.apimgr.us
 After=network-online.target
 Wants=network-online.target
-
+%s
 [Service]
 Type=simple
 User=root
@@ -133,13 +187,14 @@ NoNewPrivileges=true
 ProtectSystem=strict
 ProtectHome=read-only
 PrivateTmp=true
-ReadWritePaths=/var/lib/%s/%s /var/log/%s/%s /etc/%s/%s
+ReadWritePaths=%s
 
 [Install]
 WantedBy=multi-user.target
-`, binaryPath, orgName, appName, orgName, appName, orgName, appName)
+`, socketDeps, execStart, readWritePaths)
 
 	servicePath := fmt.Sprintf("/etc/systemd/system/%s.service", appName)
+	socketPath := fmt.Sprintf("/etc/systemd/system/%s.socket", appName)
 
 	// Create directories
 	dirs := []string{
@@ -158,6 +213,14 @@ WantedBy=multi-user.target
 		return fmt.Errorf("failed to write service file: %w", err)
 	}
 
+	// Write socket file
+	if socketActivated {
+		socketContent := SystemdSocketUnit(opts.ListenStreams, opts.SocketMode)
+		if err := os.WriteFile(socketPath, []byte(socketContent), 0644); err != nil {
+			return fmt.Errorf("failed to write socket file: %w", err)
+		}
+	}
+
 	// Copy binary if not already in place
 	if exePath, err := os.Executable(); err == nil && exePath != binaryPath {
 		if err := copyBinary(exePath, binaryPath); err != nil {
@@ -170,16 +233,23 @@ WantedBy=multi-user.target
 		return fmt.Errorf("failed to reload systemd: %w", err)
 	}
 
-	// Enable service
-	if err := exec.Command("systemctl", "enable", appName).Run(); err != nil {
+	// Enable service (or its socket)
+	unit := appName
+	if socketActivated {
+		unit = appName + ".socket"
+	}
+	if err := exec.Command("systemctl", "enable", unit).Run(); err != nil {
 		return fmt.Errorf("failed to enable service: %w", err)
 	}
 
 	fmt.Printf("✅ Service installed at: %s\n", servicePath)
+	if socketActivated {
+		fmt.Printf("✅ Socket installed at: %s\n", socketPath)
+	}
 	fmt.Printf("✅ Binary installed at: %s\n", binaryPath)
 	fmt.Println()
 	fmt.Println("To start the service:")
-	fmt.Printf("  sudo systemctl start %s\n", appName)
+	fmt.Printf("  sudo systemctl start %s\n", unit)
 	fmt.Println()
 	fmt.Println("To check status:")
 	fmt.Printf("  sudo systemctl status %s\n", appName)
@@ -197,6 +267,16 @@ func uninstallSystemd() error {
 	// Disable service
 	exec.Command("systemctl", "disable", appName).Run()
 
+	// Stop and disable socket if installed
+	socketPath := fmt.Sprintf("/etc/systemd/system/%s.socket", appName)
+	if _, err := os.Stat(socketPath); err == nil {
+		exec.Command("systemctl", "stop", appName+".socket").Run()
+		exec.Command("systemctl", "disable", appName+".socket").Run()
+		if err := os.Remove(socketPath); err != nil {
+			return fmt.Errorf("failed to remove socket file: %w", err)
+		}
+	}
+
 	// Remove service file
 	if err := os.Remove(servicePath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove service file: %w", err)
@@ -0,0 +1,340 @@
+package ssl
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// ACME directory URLs
+const (
+	LetsEncryptProductionURL = acme.LetsEncryptURL
+	LetsEncryptStagingURL    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// renewBefore is how long before expiry certificates are renewed
+const renewBefore = 30 * 24 * time.Hour
+
+// dnsPropagationDelay gives the name server time to serve a new record
+// before the CA is asked to validate it
+var dnsPropagationDelay = 5 * time.Second
+
+// DNSProvider publishes dns-01 challenge TXT records
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// newACMEClient creates an ACME client for the configured directory,
+// trusting the configured CA bundle in addition to the system roots
+func newACMEClient(cfg LetsEncryptConfig, key crypto.Signer) (*acme.Client, error) {
+	directory := cfg.DirectoryURL
+	if directory == "" {
+		directory = LetsEncryptProductionURL
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: directory,
+		UserAgent:    "gitmessages",
+	}
+
+	if cfg.CABundle != "" {
+		pemData, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		client.HTTPClient = &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			},
+		}
+	}
+
+	return client, nil
+}
+
+// newDNSProvider creates the DNS provider named in the configuration
+func newDNSProvider(cfg LetsEncryptConfig) (DNSProvider, error) {
+	switch strings.ToLower(cfg.DNSProviderType) {
+	case "rfc2136":
+		if cfg.RFC2136Server == "" {
+			return nil, fmt.Errorf("rfc2136 server is required for dns-01")
+		}
+		return &RFC2136Provider{
+			Server:    cfg.RFC2136Server,
+			Zone:      cfg.RFC2136Zone,
+			KeyName:   cfg.RFC2136Name,
+			KeySecret: cfg.DNSProviderKey,
+			Algorithm: cfg.RFC2136Algo,
+		}, nil
+	case "":
+		return nil, fmt.Errorf("dns_provider is required for dns-01")
+	default:
+		return nil, fmt.Errorf("unsupported DNS provider: %s", cfg.DNSProviderType)
+	}
+}
+
+// dnsIssuer obtains and renews certificates using dns-01 challenges
+type dnsIssuer struct {
+	cfg      LetsEncryptConfig
+	domains  []string
+	cacheDir string
+	provider DNSProvider
+	client   *acme.Client
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newDNSIssuer prepares an issuer, loading any cached certificate
+func newDNSIssuer(cfg LetsEncryptConfig, domains []string, cacheDir string) (*dnsIssuer, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains configured")
+	}
+	provider, err := newDNSProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dnsIssuer{
+		cfg:      cfg,
+		domains:  domains,
+		cacheDir: cacheDir,
+		provider: provider,
+	}
+
+	key, err := d.accountKey()
+	if err != nil {
+		return nil, err
+	}
+	if d.client, err = newACMEClient(cfg, key); err != nil {
+		return nil, err
+	}
+
+	if cert, err := tls.LoadX509KeyPair(d.certFile(), d.certFile()); err == nil {
+		d.cert = &cert
+	}
+	return d, nil
+}
+
+// GetCertificate returns the current certificate for TLS handshakes
+func (d *dnsIssuer) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.cert == nil {
+		return nil, fmt.Errorf("certificate not yet issued")
+	}
+	return d.cert, nil
+}
+
+// needsRenewal reports whether the certificate is missing or expiring soon
+func (d *dnsIssuer) needsRenewal() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.cert == nil || d.cert.Leaf == nil {
+		return true
+	}
+	return time.Until(d.cert.Leaf.NotAfter) < renewBefore
+}
+
+// renewLoop periodically renews the certificate before it expires
+func (d *dnsIssuer) renewLoop() {
+	ticker := time.NewTicker(12 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !d.needsRenewal() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if err := d.obtain(ctx); err != nil {
+			logging.Errorf("SSL: dns-01 renewal failed: %v", err)
+		}
+		cancel()
+	}
+}
+
+// obtain runs the full ACME order flow using dns-01 challenges
+func (d *dnsIssuer) obtain(ctx context.Context) error {
+	acct := &acme.Account{}
+	if d.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + d.cfg.Email}
+	}
+	if _, err := d.client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("account registration failed: %w", err)
+	}
+
+	order, err := d.client.AuthorizeOrder(ctx, acme.DomainIDs(d.domains...))
+	if err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := d.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+
+	if order, err = d.client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("order not ready: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: d.domains[0]},
+		DNSNames: d.domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	der, _, err := d.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("certificate issuance failed: %w", err)
+	}
+
+	return d.store(key, der)
+}
+
+// authorize fulfils a single authorization with a dns-01 challenge
+func (d *dnsIssuer) authorize(ctx context.Context, authzURL string) error {
+	authz, err := d.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := d.client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+	fqdn := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+
+	if err := d.provider.Present(ctx, fqdn, value); err != nil {
+		return err
+	}
+	defer func() {
+		if err := d.provider.CleanUp(context.Background(), fqdn, value); err != nil {
+			logging.Warnf("SSL: failed to remove %s: %v", fqdn, err)
+		}
+	}()
+
+	select {
+	case <-time.After(dnsPropagationDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if _, err := d.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("challenge accept failed: %w", err)
+	}
+	if _, err := d.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s failed: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// store writes the key and chain to the cache and activates the certificate
+func (d *dnsIssuer) store(key *ecdsa.PrivateKey, der [][]byte) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, b := range der {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+
+	if err := os.WriteFile(d.certFile(), data, 0600); err != nil {
+		return fmt.Errorf("failed to store certificate: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.cert = &cert
+	d.mu.Unlock()
+
+	log.Printf("SSL: dns-01 certificate issued for %s (expires %s)",
+		strings.Join(d.domains, ", "), cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// certFile is the cache file holding the key and certificate chain
+func (d *dnsIssuer) certFile() string {
+	return filepath.Join(d.cacheDir, d.domains[0]+"+dns01.pem")
+}
+
+// accountKey loads or creates the ACME account key
+func (d *dnsIssuer) accountKey() (crypto.Signer, error) {
+	path := filepath.Join(d.cacheDir, "acme_account+dns01.key")
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid account key in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to store account key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,115 @@
+//go:build acme
+
+package ssl
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// These tests issue certificates from a local Pebble CA with BIND serving
+// the dns-01 records. Start both with tests/integration/acme/run.sh, or
+// run: go test -tags acme ./src/ssl with the ACME_* variables below set.
+
+const testDomain = "gitmessages.test"
+
+// pebbleConfig returns the issuance settings for the test CA, skipping the
+// test when no CA bundle is configured
+func pebbleConfig(t *testing.T, challenge string) LetsEncryptConfig {
+	t.Helper()
+	bundle := os.Getenv("ACME_CA_BUNDLE")
+	if bundle == "" {
+		t.Skip("ACME_CA_BUNDLE not set; start Pebble with tests/integration/acme/run.sh")
+	}
+	return LetsEncryptConfig{
+		Enabled:         true,
+		Email:           "admin@" + testDomain,
+		Challenge:       challenge,
+		DirectoryURL:    envOr("ACME_DIRECTORY_URL", "https://localhost:14000/dir"),
+		CABundle:        bundle,
+		DNSProviderType: "rfc2136",
+		DNSProviderKey:  "Z2l0bWVzc2FnZXMtYWNtZS10ZXN0LWtleS0wMDAx",
+		RFC2136Server:   envOr("ACME_DNS_SERVER", "127.0.0.1:15353"),
+		RFC2136Zone:     testDomain,
+		RFC2136Name:     "acme-update",
+		RFC2136Algo:     "hmac-sha256",
+	}
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func TestPebbleDNS01Issuance(t *testing.T) {
+	cfg := pebbleConfig(t, "dns-01")
+	dnsPropagationDelay = time.Second
+
+	issuer, err := newDNSIssuer(cfg, []string{testDomain}, t.TempDir())
+	if err != nil {
+		t.Fatalf("newDNSIssuer: %v", err)
+	}
+	if !issuer.needsRenewal() {
+		t.Fatal("fresh issuer should need a certificate")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := issuer.obtain(ctx); err != nil {
+		t.Fatalf("obtain: %v", err)
+	}
+
+	cert, err := issuer.GetCertificate(&tls.ClientHelloInfo{ServerName: testDomain})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname(testDomain); err != nil {
+		t.Errorf("issued certificate: %v", err)
+	}
+	if issuer.needsRenewal() {
+		t.Error("issued certificate should not need renewal")
+	}
+	if _, err := os.Stat(issuer.certFile()); err != nil {
+		t.Errorf("certificate not cached: %v", err)
+	}
+}
+
+func TestPebbleManagerUsesCachedCertificate(t *testing.T) {
+	cfg := pebbleConfig(t, "dns-01")
+	dnsPropagationDelay = time.Second
+	certPath := t.TempDir()
+
+	m := NewManager(Config{Enabled: true, CertPath: certPath, LetsEncrypt: cfg})
+	tlsConfig, err := m.GetTLSConfig([]string{testDomain})
+	if err != nil {
+		t.Fatalf("GetTLSConfig: %v", err)
+	}
+	first, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: testDomain})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+
+	// A second manager finds the cached certificate instead of ordering again
+	cached, err := os.ReadFile(filepath.Join(certPath, "autocert", testDomain+"+dns01.pem"))
+	if err != nil {
+		t.Fatalf("certificate not cached: %v", err)
+	}
+	m = NewManager(Config{Enabled: true, CertPath: certPath, LetsEncrypt: cfg})
+	tlsConfig, err = m.GetTLSConfig([]string{testDomain})
+	if err != nil {
+		t.Fatalf("GetTLSConfig with cache: %v", err)
+	}
+	second, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: testDomain})
+	if err != nil {
+		t.Fatalf("GetCertificate with cache: %v", err)
+	}
+	if !second.Leaf.Equal(first.Leaf) || len(cached) == 0 {
+		t.Error("second manager ordered a new certificate instead of using the cache")
+	}
+}
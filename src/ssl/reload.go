@@ -0,0 +1,260 @@
+package ssl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apimgr/gitmessages/src/logging"
+)
+
+// reloadCheckInterval limits how often certificate files are stat'ed
+const reloadCheckInterval = 5 * time.Second
+
+// Certificate expiry thresholds
+const (
+	ExpiryWarning  = 30 * 24 * time.Hour
+	ExpiryCritical = 7 * 24 * time.Hour
+)
+
+// CertInfo describes a certificate in use
+type CertInfo struct {
+	Source    string    `json:"source"`
+	Path      string    `json:"path,omitempty"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"sans"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"`
+	Status    string    `json:"status"`
+}
+
+// newCertInfo builds a CertInfo from a parsed certificate
+func newCertInfo(source, path string, leaf *x509.Certificate) CertInfo {
+	left := time.Until(leaf.NotAfter)
+	status := "ok"
+	switch {
+	case left <= 0:
+		status = "expired"
+	case left < ExpiryCritical:
+		status = "critical"
+	case left < ExpiryWarning:
+		status = "expiring"
+	}
+
+	return CertInfo{
+		Source:    source,
+		Path:      path,
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		DNSNames:  leaf.DNSNames,
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+		DaysLeft:  int(left.Hours() / 24),
+		Status:    status,
+	}
+}
+
+// certReloader serves a certificate from disk and reloads it when the
+// certificate or key file changes, so renewals (e.g. by certbot) are
+// picked up without a restart
+type certReloader struct {
+	source   string
+	certPath string
+	keyPath  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+// newCertReloader loads the certificate once and returns a reloader
+func newCertReloader(source, certPath, keyPath string) (*certReloader, error) {
+	cr := &certReloader{
+		source:   source,
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// load reads the key pair from disk
+func (cr *certReloader) load() error {
+	certStat, err := os.Stat(cr.certPath)
+	if err != nil {
+		return err
+	}
+	keyStat, err := os.Stat(cr.keyPath)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.certMod = certStat.ModTime()
+	cr.keyMod = keyStat.ModTime()
+	cr.lastCheck = time.Now()
+	cr.mu.Unlock()
+	return nil
+}
+
+// changed reports whether either file was modified since the last load
+func (cr *certReloader) changed() bool {
+	certStat, err := os.Stat(cr.certPath)
+	if err != nil {
+		return false
+	}
+	keyStat, err := os.Stat(cr.keyPath)
+	if err != nil {
+		return false
+	}
+
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return !certStat.ModTime().Equal(cr.certMod) || !keyStat.ModTime().Equal(cr.keyMod)
+}
+
+// Check reloads the certificate if the files changed. A failed reload
+// keeps serving the previous certificate.
+func (cr *certReloader) Check() {
+	cr.mu.Lock()
+	cr.lastCheck = time.Now()
+	cr.mu.Unlock()
+
+	if !cr.changed() {
+		return
+	}
+	if err := cr.load(); err != nil {
+		logging.Errorf("SSL: Failed to reload %s, keeping previous certificate: %v", cr.certPath, err)
+		return
+	}
+	log.Printf("SSL: Reloaded certificate %s", cr.certPath)
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	due := time.Since(cr.lastCheck) > reloadCheckInterval
+	cr.mu.RUnlock()
+
+	if due {
+		cr.Check()
+	}
+
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// Info returns details about the loaded certificate
+func (cr *certReloader) Info() (CertInfo, bool) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	if cr.cert == nil || cr.cert.Leaf == nil {
+		return CertInfo{}, false
+	}
+	return newCertInfo(cr.source, cr.certPath, cr.cert.Leaf), true
+}
+
+// Certificates returns details about every certificate the manager serves
+func (m *Manager) Certificates() []CertInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var infos []CertInfo
+
+	if m.reloader != nil {
+		if info, ok := m.reloader.Info(); ok {
+			infos = append(infos, info)
+		}
+	}
+
+	if m.dnsIssuer != nil {
+		m.dnsIssuer.mu.RLock()
+		if m.dnsIssuer.cert != nil && m.dnsIssuer.cert.Leaf != nil {
+			infos = append(infos, newCertInfo("acme-dns-01", m.dnsIssuer.certFile(), m.dnsIssuer.cert.Leaf))
+		}
+		m.dnsIssuer.mu.RUnlock()
+	}
+
+	if m.certManager != nil {
+		// autocert keeps issued certificates in its cache keyed by domain
+		for _, domain := range m.domains {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			data, err := m.certManager.Cache.Get(ctx, domain)
+			cancel()
+			if err != nil {
+				continue
+			}
+			if leaf := firstCertificate(data); leaf != nil {
+				infos = append(infos, newCertInfo("acme", "", leaf))
+			}
+		}
+	}
+
+	return infos
+}
+
+// CheckCertificates reloads changed certificate files and logs a warning
+// for every certificate that is close to expiry
+func (m *Manager) CheckCertificates() error {
+	m.mu.RLock()
+	reloader := m.reloader
+	m.mu.RUnlock()
+
+	if reloader != nil {
+		reloader.Check()
+	}
+
+	var expired []string
+	for _, info := range m.Certificates() {
+		switch info.Status {
+		case "expired":
+			logging.Errorf("SSL: Certificate %s expired on %s", info.Subject, info.NotAfter.Format(time.RFC3339))
+			expired = append(expired, info.Subject)
+		case "critical", "expiring":
+			logging.Warnf("SSL: certificate %s expires in %d days (%s)",
+				info.Subject, info.DaysLeft, info.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	if len(expired) > 0 {
+		return fmt.Errorf("%d certificate(s) expired", len(expired))
+	}
+	return nil
+}
+
+// firstCertificate parses the first CERTIFICATE block in PEM data
+func firstCertificate(data []byte) *x509.Certificate {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil
+			}
+			return cert
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package ssl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS constants used by RFC 2136 dynamic updates
+const (
+	dnsOpcodeUpdate = 5
+	dnsTypeSOA      = 6
+	dnsTypeTXT      = 16
+	dnsTypeTSIG     = 250
+	dnsClassIN      = 1
+	dnsClassNone    = 254
+	dnsClassAny     = 255
+	tsigFudge       = 300
+)
+
+// RFC2136Provider presents dns-01 challenge records through RFC 2136
+// dynamic updates signed with a TSIG key
+type RFC2136Provider struct {
+	Server    string // host:port of the authoritative name server
+	Zone      string // zone to update; derived from the record name if empty
+	KeyName   string // TSIG key name
+	KeySecret string // base64 encoded TSIG secret
+	Algorithm string // hmac-sha256 (default), hmac-sha512, hmac-sha1, hmac-md5
+	TTL       uint32
+	Timeout   time.Duration
+}
+
+// Present adds the TXT record for a dns-01 challenge
+func (p *RFC2136Provider) Present(ctx context.Context, fqdn, value string) error {
+	return p.update(ctx, fqdn, value, false)
+}
+
+// CleanUp removes the TXT record for a dns-01 challenge
+func (p *RFC2136Provider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.update(ctx, fqdn, value, true)
+}
+
+// update sends a signed UPDATE message adding or deleting a single TXT record
+func (p *RFC2136Provider) update(ctx context.Context, fqdn, value string, remove bool) error {
+	fqdn = canonicalName(fqdn)
+	zone := canonicalName(p.Zone)
+	if p.Zone == "" {
+		zone = guessZone(fqdn)
+	}
+
+	ttl := p.TTL
+	if ttl == 0 {
+		ttl = 60
+	}
+
+	msg, id, err := buildUpdate(zone, fqdn, value, ttl, remove)
+	if err != nil {
+		return err
+	}
+	if p.KeyName != "" {
+		msg, err = signTSIG(msg, id, p.KeyName, p.Algorithm, p.KeySecret, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := p.exchange(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("rfc2136 update to %s failed: %w", p.Server, err)
+	}
+	if len(resp) < 12 || binary.BigEndian.Uint16(resp[0:2]) != id {
+		return fmt.Errorf("rfc2136 update to %s: malformed response", p.Server)
+	}
+	if rcode := binary.BigEndian.Uint16(resp[2:4]) & 0x000F; rcode != 0 {
+		return fmt.Errorf("rfc2136 update to %s rejected: %s", p.Server, rcodeName(rcode))
+	}
+	return nil
+}
+
+// exchange sends a DNS message over TCP and returns the response
+func (p *RFC2136Provider) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	server := p.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// buildUpdate encodes an UPDATE message with one zone and one update record
+func buildUpdate(zone, name, value string, ttl uint32, remove bool) ([]byte, uint16, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	zoneWire, err := encodeName(zone)
+	if err != nil {
+		return nil, 0, err
+	}
+	nameWire, err := encodeName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(value) > 255 {
+		return nil, 0, fmt.Errorf("TXT value too long")
+	}
+
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsOpcodeUpdate<<11)
+	binary.BigEndian.PutUint16(msg[4:], 1) // ZOCOUNT
+	binary.BigEndian.PutUint16(msg[8:], 1) // UPCOUNT
+
+	// Zone section
+	msg = append(msg, zoneWire...)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeSOA)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+
+	// Update section: class NONE deletes the exact record (RFC 2136 2.5.4)
+	class := uint16(dnsClassIN)
+	if remove {
+		class = dnsClassNone
+		ttl = 0
+	}
+	rdata := append([]byte{byte(len(value))}, value...)
+	msg = append(msg, nameWire...)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeTXT)
+	msg = binary.BigEndian.AppendUint16(msg, class)
+	msg = binary.BigEndian.AppendUint32(msg, ttl)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+	msg = append(msg, rdata...)
+
+	return msg, id, nil
+}
+
+// signTSIG appends a TSIG record (RFC 8945) to msg
+func signTSIG(msg []byte, id uint16, keyName, algorithm, secret string, now time.Time) ([]byte, error) {
+	algName, newHash, err := tsigAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret: %w", err)
+	}
+	keyWire, err := encodeName(canonicalName(keyName))
+	if err != nil {
+		return nil, err
+	}
+	algWire, err := encodeName(algName)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeSigned [6]byte
+	ts := uint64(now.Unix())
+	for i := 5; i >= 0; i-- {
+		timeSigned[i] = byte(ts)
+		ts >>= 8
+	}
+
+	// TSIG variables covered by the MAC
+	vars := append([]byte{}, keyWire...)
+	vars = binary.BigEndian.AppendUint16(vars, dnsClassAny)
+	vars = binary.BigEndian.AppendUint32(vars, 0)
+	vars = append(vars, algWire...)
+	vars = append(vars, timeSigned[:]...)
+	vars = binary.BigEndian.AppendUint16(vars, tsigFudge)
+	vars = binary.BigEndian.AppendUint16(vars, 0) // error
+	vars = binary.BigEndian.AppendUint16(vars, 0) // other len
+
+	mac := hmac.New(newHash, key)
+	mac.Write(msg)
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	rdata := append([]byte{}, algWire...)
+	rdata = append(rdata, timeSigned[:]...)
+	rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = binary.BigEndian.AppendUint16(rdata, id)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // error
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // other len
+
+	signed := append([]byte{}, msg...)
+	signed = append(signed, keyWire...)
+	signed = binary.BigEndian.AppendUint16(signed, dnsTypeTSIG)
+	signed = binary.BigEndian.AppendUint16(signed, dnsClassAny)
+	signed = binary.BigEndian.AppendUint32(signed, 0)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+
+	// ARCOUNT now includes the TSIG record
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+	return signed, nil
+}
+
+// tsigAlgorithm maps a configured algorithm to its TSIG name and hash
+func tsigAlgorithm(algorithm string) (string, func() hash.Hash, error) {
+	switch strings.TrimSuffix(strings.ToLower(algorithm), ".") {
+	case "", "hmac-sha256":
+		return "hmac-sha256.", sha256.New, nil
+	case "hmac-sha512":
+		return "hmac-sha512.", sha512.New, nil
+	case "hmac-sha1":
+		return "hmac-sha1.", sha1.New, nil
+	case "hmac-md5", "hmac-md5.sig-alg.reg.int":
+		return "hmac-md5.sig-alg.reg.int.", md5.New, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported TSIG algorithm: %s", algorithm)
+	}
+}
+
+// encodeName encodes a fully qualified domain name in DNS wire format
+func encodeName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	var out []byte
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid DNS name: %s", name)
+			}
+			out = append(out, byte(len(label)))
+			out = append(out, strings.ToLower(label)...)
+		}
+	}
+	return append(out, 0), nil
+}
+
+// canonicalName lowercases a name and ensures a trailing dot
+func canonicalName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// guessZone assumes the zone is the registered domain (last two labels)
+// of the record name. Set the zone explicitly for deeper delegations.
+func guessZone(fqdn string) string {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	if len(labels) <= 2 {
+		return fqdn
+	}
+	return strings.Join(labels[len(labels)-2:], ".") + "."
+}
+
+// rcodeName returns a readable name for a DNS response code
+func rcodeName(rcode uint16) string {
+	names := map[uint16]string{
+		1:  "FORMERR",
+		2:  "SERVFAIL",
+		3:  "NXDOMAIN",
+		4:  "NOTIMP",
+		5:  "REFUSED",
+		6:  "YXDOMAIN",
+		7:  "YXRRSET",
+		8:  "NXRRSET",
+		9:  "NOTAUTH",
+		10: "NOTZONE",
+	}
+	if name, ok := names[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
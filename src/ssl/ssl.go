@@ -1,6 +1,7 @@
 package ssl
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/crypto/acme/autocert"
 )
@@ -20,14 +22,19 @@ type Config struct {
 	LetsEncrypt LetsEncryptConfig
 }
 
-// LetsEncryptConfig holds Let's Encrypt settings
+// LetsEncryptConfig holds Let's Encrypt settings.
+// Any ACME CA can be used by setting DirectoryURL; CABundle adds a PEM
+// bundle trusted when talking to it (e.g. a local Pebble test CA).
 type LetsEncryptConfig struct {
 	Enabled         bool
 	Email           string
 	Challenge       string // http-01, tls-alpn-01, dns-01
+	DirectoryURL    string
+	CABundle        string
 	DNSProviderType string
-	DNSProviderKey  string
+	DNSProviderKey  string // rfc2136: base64 TSIG secret
 	RFC2136Server   string
+	RFC2136Zone     string
 	RFC2136Name     string
 	RFC2136Algo     string
 }
@@ -36,6 +43,9 @@ type LetsEncryptConfig struct {
 type Manager struct {
 	config      Config
 	certManager *autocert.Manager
+	dnsIssuer   *dnsIssuer
+	reloader    *certReloader
+	domains     []string
 	mu          sync.RWMutex
 }
 
@@ -54,18 +64,12 @@ func (m *Manager) GetTLSConfig(domains []string) (*tls.Config, error) {
 	if !m.config.Enabled {
 		return nil, nil
 	}
+	m.domains = domains
 
 	// Check for existing certificates first (e.g., from /etc/letsencrypt/live)
 	if cert, key := m.findExistingCerts(domains); cert != "" && key != "" {
 		log.Printf("Using existing certificate: %s", cert)
-		tlsCert, err := tls.LoadX509KeyPair(cert, key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load certificate: %w", err)
-		}
-		return &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-			MinVersion:   tls.VersionTLS12,
-		}, nil
+		return m.getFileTLSConfig("existing", cert, key)
 	}
 
 	// Use Let's Encrypt if enabled
@@ -76,39 +80,83 @@ func (m *Manager) GetTLSConfig(domains []string) (*tls.Config, error) {
 	// Check for manual certificates
 	if cert, key := m.findManualCerts(domains); cert != "" && key != "" {
 		log.Printf("Using manual certificate: %s", cert)
-		tlsCert, err := tls.LoadX509KeyPair(cert, key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load certificate: %w", err)
-		}
-		return &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-			MinVersion:   tls.VersionTLS12,
-		}, nil
+		return m.getFileTLSConfig("manual", cert, key)
 	}
 
 	return nil, fmt.Errorf("no certificates available and Let's Encrypt not enabled")
 }
 
-// getLetsEncryptTLSConfig configures autocert for Let's Encrypt
+// getFileTLSConfig serves a certificate from disk, reloading it on change
+func (m *Manager) getFileTLSConfig(source, cert, key string) (*tls.Config, error) {
+	reloader, err := newCertReloader(source, cert, key)
+	if err != nil {
+		return nil, err
+	}
+	m.reloader = reloader
+
+	return &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+// getLetsEncryptTLSConfig configures ACME issuance. http-01 and
+// tls-alpn-01 are handled by autocert, dns-01 by the built-in issuer.
 func (m *Manager) getLetsEncryptTLSConfig(domains []string) (*tls.Config, error) {
 	cacheDir := filepath.Join(m.config.CertPath, "autocert")
 	if err := os.MkdirAll(cacheDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create cert cache dir: %w", err)
 	}
 
+	if ParseChallenge(m.config.LetsEncrypt.Challenge) == "dns-01" {
+		return m.getDNS01TLSConfig(domains, cacheDir)
+	}
+
+	client, err := newACMEClient(m.config.LetsEncrypt, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	m.certManager = &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
 		HostPolicy: autocert.HostWhitelist(domains...),
 		Cache:      autocert.DirCache(cacheDir),
 		Email:      m.config.LetsEncrypt.Email,
+		Client:     client,
 	}
 
 	return m.certManager.TLSConfig(), nil
 }
 
-// GetHTTPHandler returns HTTP handler for ACME challenges
+// getDNS01TLSConfig obtains a certificate through dns-01 before returning
+// and keeps renewing it in the background
+func (m *Manager) getDNS01TLSConfig(domains []string, cacheDir string) (*tls.Config, error) {
+	issuer, err := newDNSIssuer(m.config.LetsEncrypt, domains, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if issuer.needsRenewal() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := issuer.obtain(ctx); err != nil {
+			return nil, fmt.Errorf("dns-01 issuance failed: %w", err)
+		}
+	}
+
+	m.dnsIssuer = issuer
+	go issuer.renewLoop()
+
+	return &tls.Config{
+		GetCertificate: issuer.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+// GetHTTPHandler returns HTTP handler for ACME challenges. Only http-01
+// needs the HTTP listener; with tls-alpn-01 and dns-01 it is the fallback.
 func (m *Manager) GetHTTPHandler(fallback http.Handler) http.Handler {
-	if m.certManager != nil {
+	if m.certManager != nil && ParseChallenge(m.config.LetsEncrypt.Challenge) == "http-01" {
 		return m.certManager.HTTPHandler(fallback)
 	}
 	return fallback
@@ -149,54 +197,6 @@ func (m *Manager) findManualCerts(domains []string) (certPath, keyPath string) {
 	return "", ""
 }
 
-// ChallengeServer handles ACME HTTP-01 challenges
-type ChallengeServer struct {
-	tokens map[string]string
-	mu     sync.RWMutex
-}
-
-// NewChallengeServer creates a challenge server
-func NewChallengeServer() *ChallengeServer {
-	return &ChallengeServer{
-		tokens: make(map[string]string),
-	}
-}
-
-// SetToken sets a challenge token
-func (cs *ChallengeServer) SetToken(token, auth string) {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
-	cs.tokens[token] = auth
-}
-
-// ClearToken removes a challenge token
-func (cs *ChallengeServer) ClearToken(token string) {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
-	delete(cs.tokens, token)
-}
-
-// ServeHTTP handles ACME challenge requests
-func (cs *ChallengeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) bool {
-	if !strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
-		return false
-	}
-
-	token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
-	cs.mu.RLock()
-	auth, ok := cs.tokens[token]
-	cs.mu.RUnlock()
-
-	if !ok {
-		http.NotFound(w, r)
-		return true
-	}
-
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write([]byte(auth))
-	return true
-}
-
 // ParseChallenge parses challenge type from string
 func ParseChallenge(s string) string {
 	s = strings.ToLower(strings.TrimSpace(s))